@@ -18,30 +18,91 @@
 package event
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
 )
 
 // TypeMuxEvent is a time-tagged notification pushed to subscribers.
 type TypeMuxEvent struct {
-	Time time.Time
+	Time time.Time // wall clock time of the Post call
+	Seq  uint64    // position in the posting order of the mux, starting at 1
 	Data interface{}
+
+	posted mclock.AbsTime // mux clock at the Post call, set if metrics are enabled
 }
 
 // A TypeMux dispatches events to registered receivers. Receivers can be
 // registered to handle events of certain type. Any operation
 // called after mux is stopped will return ErrMuxClosed.
 //
-// The zero value is ready to use.
+// The zero value is ready to use. Use NewTypeMux to enable optional features.
 //
 // Deprecated: use Feed
 type TypeMux struct {
-	mutex   sync.RWMutex
-	subm    map[reflect.Type][]*TypeMuxSubscription
-	stopped bool
+	config   TypeMuxConfig
+	mutex    sync.RWMutex
+	subm     map[reflect.Type][]*TypeMuxSubscription
+	ifacem   map[reflect.Type][]*TypeMuxSubscription // interface subscriptions
+	taps     []*TypeMuxSubscription                  // subscriptions to all events
+	stopped  bool
+	inflight sync.WaitGroup // Post calls in progress
+	seq      atomic.Uint64  // sequence number of the last posted event
+	nextID   atomic.Uint64  // ID of the last subscription
+	stats    *muxMetrics    // nil unless metrics are enabled
+
+	// routes caches the resolved subscribers of each posted type while there
+	// are interface subscriptions. It is reset whenever subscriptions change.
+	routeMu sync.Mutex
+	routes  map[reflect.Type][]*TypeMuxSubscription
+
+	// history retains the latest events of each type for SubscribeWithReplay.
+	histMu  sync.Mutex
+	history map[reflect.Type]*eventRing
+	histSeq uint64
+}
+
+// TypeMuxConfig contains the optional features of a TypeMux.
+type TypeMuxConfig struct {
+	// Parallel makes Post deliver an event to all of its subscribers concurrently
+	// instead of one after another. Post still returns only once every subscriber
+	// has been handled, so each subscriber sees events in posting order.
+	Parallel bool
+
+	// History is the number of recent events retained per type for
+	// SubscribeWithReplay. Zero disables history.
+	History int
+
+	// Journal, if set, records every posted event before it is delivered.
+	// Post fails without delivering if the event cannot be journaled.
+	Journal *Journal
+
+	// Clock is the time source for delivery timeouts and metrics. It defaults
+	// to the system clock. Event timestamps always use the wall clock.
+	Clock mclock.Clock
+
+	// LeakDetector, if set, tracks the subscriptions of the mux and reports
+	// those that look leaked. It is meant for debugging.
+	LeakDetector *LeakDetector
+
+	// Metrics enables collecting the counters and histograms returned by
+	// TypeMux.Metrics.
+	Metrics bool
+}
+
+// NewTypeMux creates a mux with the given configuration.
+func NewTypeMux(config TypeMuxConfig) *TypeMux {
+	mux := &TypeMux{config: config}
+	if config.Metrics {
+		mux.stats = &muxMetrics{types: make(map[reflect.Type]*typeMetrics)}
+	}
+	return mux
 }
 
 // ErrMuxClosed is returned when Posting on a closed TypeMux.
@@ -51,52 +112,301 @@ var ErrMuxClosed = errors.New("event: mux closed")
 // subscription's channel is closed when it is unsubscribed
 // or the mux is closed.
 func (mux *TypeMux) Subscribe(types ...interface{}) *TypeMuxSubscription {
-	sub := newsub(mux)
+	return mux.subscribe(newsub(mux, SubscribeOptions{}), typesOf(types))
+}
+
+// OverflowPolicy selects what a buffered subscription does with an event
+// when its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes Post wait until the subscriber has room for the event.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the event being posted.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest queued event to make room.
+	OverflowDropOldest
+	// OverflowUnsubscribe ends the subscription with ErrSubscriptionOverflow.
+	OverflowUnsubscribe
+)
+
+var (
+	// ErrSubscriptionOverflow is reported by TypeMuxSubscription.Err when a
+	// subscription using OverflowUnsubscribe was removed because its queue was full.
+	ErrSubscriptionOverflow = errors.New("event: subscription queue overflow")
+
+	// ErrDeliveryTimeout is reported by TypeMuxSubscription.Err when a subscriber
+	// did not accept an event within its delivery timeout.
+	ErrDeliveryTimeout = errors.New("event: subscriber delivery timeout")
+)
+
+// SubscribeOptions configures a subscription created by SubscribeWithOptions.
+// The zero value gives the behaviour of Subscribe.
+type SubscribeOptions struct {
+	QueueSize int            // number of events buffered for the subscriber
+	Overflow  OverflowPolicy // what to do when the queue is full
+
+	// DeliveryTimeout bounds how long Post waits for a blocking subscriber to
+	// accept an event. A subscriber that misses the deadline is unsubscribed
+	// with ErrDeliveryTimeout. Zero means wait indefinitely.
+	DeliveryTimeout time.Duration
+}
+
+// SubscribeWithOptions creates a subscription for events of the given types
+// whose channel buffers up to opts.QueueSize events. When the buffer is full,
+// opts.Overflow decides whether Post blocks, drops an event or ends the
+// subscription. Policies other than OverflowBlock require a positive QueueSize.
+func (mux *TypeMux) SubscribeWithOptions(opts SubscribeOptions, types ...interface{}) *TypeMuxSubscription {
+	if opts.QueueSize < 0 || (opts.QueueSize == 0 && opts.Overflow != OverflowBlock) {
+		panic(fmt.Sprintf("event: invalid queue size %d for overflow policy %d", opts.QueueSize, opts.Overflow))
+	}
+	return mux.subscribe(newsub(mux, opts), typesOf(types))
+}
+
+// SubscribeInterface creates a subscription for all events whose type implements
+// one of the given interfaces. Each interface is passed as a nil pointer to it, e.g.
+// (*ChainEvent)(nil). Note that an interface implemented by a value type T is also
+// implemented by *T, so such a subscription receives both.
+func (mux *TypeMux) SubscribeInterface(ifaces ...interface{}) *TypeMuxSubscription {
+	rtypes := make([]reflect.Type, len(ifaces))
+	for i, iface := range ifaces {
+		rtyp := reflect.TypeOf(iface)
+		if rtyp == nil || rtyp.Kind() != reflect.Pointer || rtyp.Elem().Kind() != reflect.Interface {
+			panic(fmt.Sprintf("event: %v is not a pointer to an interface type in SubscribeInterface", rtyp))
+		}
+		rtypes[i] = rtyp.Elem()
+	}
+	return mux.subscribe(newsub(mux, SubscribeOptions{}), rtypes)
+}
+
+// SubscribeContext creates a subscription for events of the given types which
+// is unsubscribed automatically when ctx ends.
+func (mux *TypeMux) SubscribeContext(ctx context.Context, types ...interface{}) *TypeMuxSubscription {
+	sub := mux.Subscribe(types...)
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				sub.Unsubscribe()
+			case <-sub.closing:
+			}
+		}()
+	}
+	return sub
+}
+
+// SubscribeFunc creates a subscription for events of the given types which only
+// receives events for which filter returns true. The filter runs in the posting
+// goroutine before the event is queued, so it must be fast and must not block.
+// It can be replaced later with SetFilter.
+func (mux *TypeMux) SubscribeFunc(filter func(interface{}) bool, types ...interface{}) *TypeMuxSubscription {
+	sub := newsub(mux, SubscribeOptions{})
+	sub.SetFilter(filter)
+	return mux.subscribe(sub, typesOf(types))
+}
+
+func typesOf(types []interface{}) []reflect.Type {
+	rtypes := make([]reflect.Type, len(types))
+	for i, t := range types {
+		rtypes[i] = reflect.TypeOf(t)
+	}
+	return rtypes
+}
+
+// subscribe registers sub for the given types. Interface types are matched
+// against the type of each posted event. If the mux is stopped, the
+// subscription is returned closed.
+func (mux *TypeMux) subscribe(sub *TypeMuxSubscription, rtypes []reflect.Type) *TypeMuxSubscription {
 	mux.mutex.Lock()
 	defer mux.mutex.Unlock()
+	mux.register(sub, rtypes)
+	return sub
+}
+
+// register adds sub to the routing tables, or closes it if the mux is stopped.
+// note: callers must hold mux.mutex
+func (mux *TypeMux) register(sub *TypeMuxSubscription, rtypes []reflect.Type) {
 	if mux.stopped {
 		// set the status to closed so that calling Unsubscribe after this
 		// call will short circuit.
 		sub.closed = true
+		close(sub.closing)
 		close(sub.postC)
-	} else {
-		if mux.subm == nil {
-			mux.subm = make(map[reflect.Type][]*TypeMuxSubscription)
+		if sub.leak != nil {
+			sub.leak.untrack()
 		}
-		for _, t := range types {
-			rtyp := reflect.TypeOf(t)
-			oldsubs := mux.subm[rtyp]
-			if find(oldsubs, sub) != -1 {
+		return
+	}
+	// Check for duplicates before registering anything, so a panic leaves the
+	// routing tables untouched.
+	for i, rtyp := range rtypes {
+		for _, prev := range rtypes[:i] {
+			if prev == rtyp {
 				panic(fmt.Sprintf("event: duplicate type %s in Subscribe", rtyp))
 			}
-			subs := make([]*TypeMuxSubscription, len(oldsubs)+1)
-			copy(subs, oldsubs)
-			subs[len(oldsubs)] = sub
-			mux.subm[rtyp] = subs
 		}
 	}
-	return sub
+	if mux.subm == nil {
+		mux.subm = make(map[reflect.Type][]*TypeMuxSubscription)
+		mux.ifacem = make(map[reflect.Type][]*TypeMuxSubscription)
+	}
+	for _, rtyp := range rtypes {
+		m := mux.subm
+		if rtyp != nil && rtyp.Kind() == reflect.Interface {
+			m = mux.ifacem
+		}
+		oldsubs := m[rtyp]
+		subs := make([]*TypeMuxSubscription, len(oldsubs)+1)
+		copy(subs, oldsubs)
+		subs[len(oldsubs)] = sub
+		m[rtyp] = subs
+	}
+	mux.routes = nil
 }
 
 // Post sends an event to all receivers registered for the given type.
 // It returns ErrMuxClosed if the mux has been stopped.
 func (mux *TypeMux) Post(ev interface{}) error {
+	_, err := mux.post(ev, nil)
+	return err
+}
+
+// PostContext is like Post, but stops delivering the event when ctx ends,
+// returning ctx.Err(). It returns the number of subscribers that received
+// the event.
+func (mux *TypeMux) PostContext(ctx context.Context, ev interface{}) (int, error) {
+	n, err := mux.post(ev, ctx.Done())
+	if err == errPostAborted {
+		err = ctx.Err()
+	}
+	return n, err
+}
+
+var errPostAborted = errors.New("event: post aborted")
+
+// post delivers ev to its subscribers, giving up when done is closed.
+func (mux *TypeMux) post(ev interface{}, done <-chan struct{}) (int, error) {
 	event := &TypeMuxEvent{
 		Time: time.Now(),
+		Seq:  mux.seq.Add(1),
 		Data: ev,
 	}
+	if mux.stats != nil {
+		event.posted = mux.clock().Now()
+	}
 	rtyp := reflect.TypeOf(ev)
 	mux.mutex.RLock()
 	if mux.stopped {
 		mux.mutex.RUnlock()
-		return ErrMuxClosed
+		return 0, ErrMuxClosed
 	}
-	subs := mux.subm[rtyp]
+	if mux.stats != nil {
+		mux.stats.get(rtyp).posts.Add(1)
+	}
+	if mux.config.Journal != nil {
+		if err := mux.config.Journal.Append(event); err != nil {
+			mux.mutex.RUnlock()
+			return 0, err
+		}
+	}
+	subs := mux.match(rtyp)
+	if mux.config.History > 0 {
+		mux.record(rtyp, event)
+	}
+	taps := mux.taps
+	mux.inflight.Add(1)
 	mux.mutex.RUnlock()
+	defer mux.inflight.Done()
+
+	// Taps never block, they are served first so that they observe events in
+	// posting order regardless of how long the typed deliveries take.
+	for _, tap := range taps {
+		tap.deliver(event, nil)
+	}
+
+	if !mux.config.Parallel || len(subs) < 2 {
+		var nsent int
+		for _, sub := range subs {
+			if isDone(done) {
+				return nsent, errPostAborted
+			}
+			if sub.deliver(event, done) {
+				nsent++
+			}
+		}
+		if nsent < len(subs) && isDone(done) {
+			return nsent, errPostAborted
+		}
+		return nsent, nil
+	}
+	var (
+		wg    sync.WaitGroup
+		nsent atomic.Int32
+	)
+	wg.Add(len(subs))
 	for _, sub := range subs {
-		sub.deliver(event)
+		go func() {
+			defer wg.Done()
+			if sub.deliver(event, done) {
+				nsent.Add(1)
+			}
+		}()
 	}
-	return nil
+	wg.Wait()
+	if int(nsent.Load()) < len(subs) && isDone(done) {
+		return int(nsent.Load()), errPostAborted
+	}
+	return int(nsent.Load()), nil
+}
+
+func isDone(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// clock returns the mux clock, defaulting to the system clock.
+func (mux *TypeMux) clock() mclock.Clock {
+	if mux.config.Clock == nil {
+		return mclock.System{}
+	}
+	return mux.config.Clock
+}
+
+// match returns the subscriptions that receive events of type rtyp: those
+// registered for the type itself followed by those registered for an
+// interface it implements.
+// note: callers must hold mux.mutex for reading
+func (mux *TypeMux) match(rtyp reflect.Type) []*TypeMuxSubscription {
+	if len(mux.ifacem) == 0 {
+		return mux.subm[rtyp]
+	}
+	mux.routeMu.Lock()
+	defer mux.routeMu.Unlock()
+	if subs, ok := mux.routes[rtyp]; ok {
+		return subs
+	}
+	subs := mux.subm[rtyp]
+	if rtyp != nil {
+		for iface, isubs := range mux.ifacem {
+			if !rtyp.Implements(iface) {
+				continue
+			}
+			for _, sub := range isubs {
+				if find(subs, sub) == -1 {
+					subs = append(subs[:len(subs):len(subs)], sub)
+				}
+			}
+		}
+	}
+	if mux.routes == nil {
+		mux.routes = make(map[reflect.Type][]*TypeMuxSubscription)
+	}
+	mux.routes[rtyp] = subs
+	return subs
 }
 
 // Stop closes a mux. The mux can no longer be used.
@@ -104,27 +414,132 @@ func (mux *TypeMux) Post(ev interface{}) error {
 // Stop blocks until all current deliveries have finished.
 func (mux *TypeMux) Stop() {
 	mux.mutex.Lock()
-	for _, subs := range mux.subm {
-		for _, sub := range subs {
-			sub.closewait()
+	mux.each(func(sub *TypeMuxSubscription) bool {
+		if sub.leak != nil {
+			sub.leak.live()
 		}
-	}
+		sub.closewait()
+		return true
+	})
 	mux.subm = nil
+	mux.ifacem = nil
+	mux.taps = nil
+	mux.routes = nil
+	mux.history = nil
+	mux.stopped = true
+	mux.mutex.Unlock()
+
+	// Closing the subscriptions released any blocked deliveries, wait for
+	// the Post calls that were still running to return.
+	mux.inflight.Wait()
+}
+
+// StopGraceful closes a mux like Stop, but first lets pending deliveries
+// finish. New Post calls fail with ErrMuxClosed right away. StopGraceful then
+// waits for in-flight Post calls to return and for subscribers to read the
+// events queued in their buffers, before closing the subscription channels.
+// If ctx ends first, the remaining events are discarded and ctx.Err() is
+// returned.
+func (mux *TypeMux) StopGraceful(ctx context.Context) error {
+	mux.mutex.Lock()
 	mux.stopped = true
 	mux.mutex.Unlock()
+
+	err := mux.drain(ctx)
+	mux.Stop()
+	return err
+}
+
+// drainInterval is how often StopGraceful checks whether the queues are empty.
+const drainInterval = 10 * time.Millisecond
+
+// drain waits until no Post is running and all subscriber queues are empty.
+// note: mux must be stopped, so no new Post calls can start
+func (mux *TypeMux) drain(ctx context.Context) error {
+	posted := make(chan struct{})
+	go func() {
+		mux.inflight.Wait()
+		close(posted)
+	}()
+	select {
+	case <-posted:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Subscribers read their queues directly, so there is no notification
+	// when they empty. Poll on the mux clock instead.
+	timer := mux.clock().NewTimer(drainInterval)
+	defer timer.Stop()
+	for mux.queued() {
+		select {
+		case <-timer.C():
+			timer.Reset(drainInterval)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// queued reports whether any subscriber has unread events in its queue.
+// Taps are not waited for, they must never slow down the mux.
+func (mux *TypeMux) queued() bool {
+	mux.mutex.RLock()
+	defer mux.mutex.RUnlock()
+	var queued bool
+	mux.each(func(sub *TypeMuxSubscription) bool {
+		if find(mux.taps, sub) != -1 {
+			return true
+		}
+		if sub.forwarded {
+			queued = sub.unread.Load() > 0
+		} else {
+			queued = len(sub.readC) > 0
+		}
+		queued = queued || sub.unreplayed.Load() > 0
+		return !queued
+	})
+	return queued
+}
+
+// each calls fn for every subscription of the mux until fn returns false.
+// Subscriptions registered for several types are visited once per type.
+// note: callers must hold mux.mutex
+func (mux *TypeMux) each(fn func(*TypeMuxSubscription) bool) {
+	for _, m := range []map[reflect.Type][]*TypeMuxSubscription{mux.subm, mux.ifacem} {
+		for _, subs := range m {
+			for _, sub := range subs {
+				if !fn(sub) {
+					return
+				}
+			}
+		}
+	}
+	for _, sub := range mux.taps {
+		if !fn(sub) {
+			return
+		}
+	}
 }
 
 func (mux *TypeMux) del(s *TypeMuxSubscription) {
 	mux.mutex.Lock()
-	for typ, subs := range mux.subm {
-		if pos := find(subs, s); pos >= 0 {
-			if len(subs) == 1 {
-				delete(mux.subm, typ)
-			} else {
-				mux.subm[typ] = posdelete(subs, pos)
+	for _, m := range []map[reflect.Type][]*TypeMuxSubscription{mux.subm, mux.ifacem} {
+		for typ, subs := range m {
+			if pos := find(subs, s); pos >= 0 {
+				if len(subs) == 1 {
+					delete(m, typ)
+				} else {
+					m[typ] = posdelete(subs, pos)
+				}
 			}
 		}
 	}
+	if pos := find(mux.taps, s); pos >= 0 {
+		mux.taps = posdelete(mux.taps, pos)
+	}
+	mux.routes = nil
 	s.mux.mutex.Unlock()
 }
 
@@ -146,11 +561,20 @@ func posdelete(slice []*TypeMuxSubscription, pos int) []*TypeMuxSubscription {
 
 // TypeMuxSubscription is a subscription established through TypeMux.
 type TypeMuxSubscription struct {
-	mux     *TypeMux
-	created time.Time
-	closeMu sync.Mutex
-	closing chan struct{}
-	closed  bool
+	mux      *TypeMux
+	created  uint64 // sequence number of the last event posted before creation
+	overflow OverflowPolicy
+	timeout  time.Duration
+	replayed chan struct{} // closed once history replay is done, nil without replay
+	filter   atomic.Pointer[func(interface{}) bool]
+	dropped  atomic.Uint64
+	leak     *leakEntry  // set if the mux has a leak detector
+	id       uint64      // identifies the subscription in metrics
+	stats    *subMetrics // nil unless the mux collects metrics
+	closeMu  sync.Mutex
+	closing  chan struct{}
+	closed   bool
+	err      error
 
 	// these two are the same channel. they are stored separately so
 	// postC can be set to nil without affecting the return value of
@@ -158,17 +582,35 @@ type TypeMuxSubscription struct {
 	postMu sync.RWMutex
 	readC  <-chan *TypeMuxEvent
 	postC  chan<- *TypeMuxEvent
+
+	// forwarded is set for the subscriptions of a TypedSubscription, whose
+	// forwarder takes events off readC before the subscriber has read them.
+	// unread then counts the events queued or held by the forwarder.
+	forwarded bool
+	unread    atomic.Int64
+
+	unreplayed atomic.Int64 // history events not yet queued by replay
 }
 
-func newsub(mux *TypeMux) *TypeMuxSubscription {
-	c := make(chan *TypeMuxEvent)
-	return &TypeMuxSubscription{
-		mux:     mux,
-		created: time.Now(),
-		readC:   c,
-		postC:   c,
-		closing: make(chan struct{}),
+func newsub(mux *TypeMux, opts SubscribeOptions) *TypeMuxSubscription {
+	c := make(chan *TypeMuxEvent, opts.QueueSize)
+	sub := &TypeMuxSubscription{
+		mux:      mux,
+		created:  mux.seq.Load(),
+		overflow: opts.Overflow,
+		timeout:  opts.DeliveryTimeout,
+		readC:    c,
+		postC:    c,
+		closing:  make(chan struct{}),
+	}
+	if mux.config.LeakDetector != nil {
+		sub.leak = mux.config.LeakDetector.track()
 	}
+	if mux.stats != nil {
+		sub.id = mux.nextID.Add(1)
+		sub.stats = new(subMetrics)
+	}
+	return sub
 }
 
 func (s *TypeMuxSubscription) Chan() <-chan *TypeMuxEvent {
@@ -180,6 +622,46 @@ func (s *TypeMuxSubscription) Unsubscribe() {
 	s.closewait()
 }
 
+// Dropped returns the number of events discarded because the subscription's
+// queue was full.
+func (s *TypeMuxSubscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Err returns the reason the mux ended the subscription, or nil if it is still
+// active or was ended by Unsubscribe or Stop.
+func (s *TypeMuxSubscription) Err() error {
+	s.closeMu.Lock()
+	defer s.closeMu.Unlock()
+	return s.err
+}
+
+// SetFilter atomically replaces the subscription's event filter. Only events
+// for which filter returns true are delivered. A nil filter accepts all events.
+func (s *TypeMuxSubscription) SetFilter(filter func(interface{}) bool) {
+	if filter == nil {
+		s.filter.Store(nil)
+	} else {
+		s.filter.Store(&filter)
+	}
+}
+
+// accepts reports whether the subscription's filter lets event through.
+func (s *TypeMuxSubscription) accepts(event *TypeMuxEvent) bool {
+	filter := s.filter.Load()
+	return filter == nil || (*filter)(event.Data)
+}
+
+// evict removes the subscription from the mux, recording err as the reason.
+func (s *TypeMuxSubscription) evict(err error) {
+	s.closeMu.Lock()
+	if !s.closed {
+		s.err = err
+	}
+	s.closeMu.Unlock()
+	s.Unsubscribe()
+}
+
 func (s *TypeMuxSubscription) closewait() {
 	s.closeMu.Lock()
 	defer s.closeMu.Unlock()
@@ -188,6 +670,9 @@ func (s *TypeMuxSubscription) closewait() {
 	}
 	close(s.closing)
 	s.closed = true
+	if s.leak != nil {
+		s.leak.untrack()
+	}
 
 	s.postMu.Lock()
 	close(s.postC)
@@ -195,17 +680,131 @@ func (s *TypeMuxSubscription) closewait() {
 	s.postMu.Unlock()
 }
 
-func (s *TypeMuxSubscription) deliver(event *TypeMuxEvent) {
-	// Short circuit delivery if stale event
-	if s.created.After(event.Time) {
-		return
+// deliver hands event to the subscriber and reports whether it was queued.
+// It gives up when done is closed.
+func (s *TypeMuxSubscription) deliver(event *TypeMuxEvent, done <-chan struct{}) bool {
+	if s.replayed != nil {
+		// Live events wait until the replayed history has been delivered. No
+		// staleness check is needed: the history snapshot and the routing change
+		// happened atomically, so every event routed here is newer.
+		select {
+		case <-s.replayed:
+		case <-s.closing:
+			return false
+		case <-done:
+			return false
+		}
+	} else if event.Seq <= s.created {
+		// Short circuit delivery if stale event. Sequence numbers are used
+		// rather than timestamps so that clock resolution does not matter.
+		if s.mux.stats != nil {
+			s.mux.stats.get(reflect.TypeOf(event.Data)).stale.Add(1)
+		}
+		return false
+	}
+	if !s.accepts(event) {
+		return false
 	}
 	// Otherwise deliver the event
+	var start mclock.AbsTime
+	if s.stats != nil {
+		start = s.mux.clock().Now()
+	}
 	s.postMu.RLock()
-	defer s.postMu.RUnlock()
+	sent, err := s.send(event, done)
+	s.postMu.RUnlock()
+
+	if s.stats != nil && sent {
+		s.stats.delivered.Add(1)
+		now := s.mux.clock().Now()
+		s.stats.blocked.observe(time.Duration(now - start))
+		s.mux.stats.get(reflect.TypeOf(event.Data)).latency.observe(time.Duration(now - event.posted))
+	}
+
+	if err != nil {
+		s.evict(err)
+	}
+	return sent
+}
 
+// send queues event according to the subscription's overflow policy and
+// reports whether it was queued.
+// note: callers must hold s.postMu for reading
+func (s *TypeMuxSubscription) send(event *TypeMuxEvent, done <-chan struct{}) (sent bool, err error) {
+	if s.postC == nil {
+		return false, nil // unsubscribed
+	}
+	if s.forwarded {
+		// Count the event before the forwarder can see it, it is uncounted
+		// once handed on.
+		s.unread.Add(1)
+		defer func() {
+			if !sent {
+				s.unread.Add(-1)
+			}
+		}()
+	}
+	switch s.overflow {
+	case OverflowDropNewest:
+		select {
+		case s.postC <- event:
+			return true, nil
+		default:
+			s.dropped.Add(1)
+			return false, nil
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.postC <- event:
+				return true, nil
+			default:
+			}
+			// Make room by discarding the head of the queue. The reader may
+			// have emptied it in the meantime, in which case we just retry.
+			select {
+			case <-s.readC:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	case OverflowUnsubscribe:
+		select {
+		case s.postC <- event:
+			return true, nil
+		default:
+			s.dropped.Add(1)
+			return false, ErrSubscriptionOverflow
+		}
+	}
+	if s.leak != nil {
+		s.leak.blocking(true)
+		defer s.leak.blocking(false)
+	}
+	if s.timeout == 0 {
+		select {
+		case s.postC <- event:
+			return true, nil
+		case <-s.closing:
+		case <-done:
+		}
+		return false, nil
+	}
+	// Avoid setting up a timer if the subscriber is ready.
+	select {
+	case s.postC <- event:
+		return true, nil
+	default:
+	}
+	timer := s.mux.clock().NewTimer(s.timeout)
+	defer timer.Stop()
 	select {
 	case s.postC <- event:
+		return true, nil
 	case <-s.closing:
+	case <-done:
+	case <-timer.C():
+		return false, ErrDeliveryTimeout
 	}
+	return false, nil
 }
@@ -1,8 +1,14 @@
 package event
 
 import (
+	"context"
+	"fmt"
+	"reflect"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
 )
 
 type DoneEvent struct{}
@@ -97,3 +103,508 @@ func TestSimulate(t *testing.T) {
 	}()
 	wg.Wait()
 }
+
+func TestSubscribeWithOptionsBlock(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	sub := mux.SubscribeWithOptions(SubscribeOptions{QueueSize: 2}, DoneEvent{})
+
+	// The queue absorbs the first two events without a reader.
+	for i := 0; i < 2; i++ {
+		if err := mux.Post(DoneEvent{}); err != nil {
+			t.Fatalf("Post return unexpected error: %v", err)
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		mux.Post(DoneEvent{})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Post did not block on full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-sub.Chan()
+	<-done
+	if n := sub.Dropped(); n != 0 {
+		t.Errorf("Got %d dropped events, expected 0", n)
+	}
+}
+
+func TestSubscribeWithOptionsDrop(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	var (
+		newest = mux.SubscribeWithOptions(SubscribeOptions{QueueSize: 2, Overflow: OverflowDropNewest}, NewMinedBlockEvent{})
+		oldest = mux.SubscribeWithOptions(SubscribeOptions{QueueSize: 2, Overflow: OverflowDropOldest}, NewMinedBlockEvent{})
+	)
+	events := []*TypeMuxEvent{}
+	for i := 0; i < 5; i++ {
+		events = append(events, &TypeMuxEvent{Time: time.Now(), Seq: uint64(i + 1), Data: NewMinedBlockEvent{}})
+	}
+	for _, ev := range events {
+		newest.deliver(ev, nil)
+		oldest.deliver(ev, nil)
+	}
+	if n := newest.Dropped(); n != 3 {
+		t.Errorf("drop-newest: got %d dropped events, expected 3", n)
+	}
+	if n := oldest.Dropped(); n != 3 {
+		t.Errorf("drop-oldest: got %d dropped events, expected 3", n)
+	}
+	if ev := <-newest.Chan(); ev != events[0] {
+		t.Errorf("drop-newest: first queued event is not the oldest posted")
+	}
+	if ev := <-oldest.Chan(); ev != events[3] {
+		t.Errorf("drop-oldest: first queued event is not the fourth posted")
+	}
+}
+
+func TestSubscribeWithOptionsUnsubscribe(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	sub := mux.SubscribeWithOptions(SubscribeOptions{QueueSize: 1, Overflow: OverflowUnsubscribe}, DoneEvent{})
+	for i := 0; i < 2; i++ {
+		if err := mux.Post(DoneEvent{}); err != nil {
+			t.Fatalf("Post return unexpected error: %v", err)
+		}
+	}
+	if err := sub.Err(); err != ErrSubscriptionOverflow {
+		t.Errorf("Got: %v, expected error: %v", err, ErrSubscriptionOverflow)
+	}
+	if n := sub.Dropped(); n != 1 {
+		t.Errorf("Got %d dropped events, expected 1", n)
+	}
+	// The queued event is still readable before the channel closes.
+	if _, isOpen := <-sub.Chan(); !isOpen {
+		t.Errorf("Queued event was lost")
+	}
+	if _, isOpen := <-sub.Chan(); isOpen {
+		t.Errorf("Subscription channel was not closed")
+	}
+}
+
+type ChainEvent interface{ BlockNumber() uint64 }
+
+func (ev ChainHeadEvent) BlockNumber() uint64 { return ev.Number }
+func (ev ChainHeadEvent) String() string      { return fmt.Sprintf("head #%d", ev.Number) }
+
+func TestSubscribeInterface(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	var (
+		iface = mux.SubscribeInterface((*ChainEvent)(nil))
+		exact = mux.Subscribe(ChainHeadEvent{})
+		both  = mux.SubscribeInterface((*ChainEvent)(nil), (*fmt.Stringer)(nil))
+	)
+	// Both the value and the pointer type implement ChainEvent.
+	posted := []interface{}{ChainHeadEvent{Number: 1}, &ChainHeadEvent{Number: 2}, DoneEvent{}}
+	go func() {
+		for _, ev := range posted {
+			if err := mux.Post(ev); err != nil {
+				t.Errorf("Post return unexpected error: %v", err)
+			}
+		}
+		iface.Unsubscribe()
+		exact.Unsubscribe()
+		both.Unsubscribe()
+	}()
+
+	collect := func(sub *TypeMuxSubscription) (got []interface{}) {
+		for ev := range sub.Chan() {
+			got = append(got, ev.Data)
+		}
+		return got
+	}
+	var (
+		wg                          sync.WaitGroup
+		gotIface, gotExact, gotBoth []interface{}
+	)
+	wg.Add(3)
+	go func() { gotIface = collect(iface); wg.Done() }()
+	go func() { gotExact = collect(exact); wg.Done() }()
+	go func() { gotBoth = collect(both); wg.Done() }()
+	wg.Wait()
+
+	if !reflect.DeepEqual(gotIface, posted[:2]) {
+		t.Errorf("interface subscription got %v, expected %v", gotIface, posted[:2])
+	}
+	if !reflect.DeepEqual(gotExact, posted[:1]) {
+		t.Errorf("exact subscription got %v, expected %v", gotExact, posted[:1])
+	}
+	// An event matching several interfaces of one subscription is delivered once.
+	if !reflect.DeepEqual(gotBoth, posted[:2]) {
+		t.Errorf("multi-interface subscription got %v, expected %v", gotBoth, posted[:2])
+	}
+}
+
+func TestSubscribeInterfaceRouteCache(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	sub := mux.SubscribeInterface((*ChainEvent)(nil))
+	mux.Post(DoneEvent{})
+	if _, ok := mux.routes[reflect.TypeOf(DoneEvent{})]; !ok {
+		t.Errorf("route for posted type was not cached")
+	}
+	sub.Unsubscribe()
+	if mux.routes != nil {
+		t.Errorf("route cache was not reset by Unsubscribe")
+	}
+}
+
+func TestSubscribeInterfaceInvalid(t *testing.T) {
+	var mux TypeMux
+	defer func() {
+		if recover() == nil {
+			t.Errorf("SubscribeInterface did not panic for non-interface type")
+		}
+	}()
+	mux.SubscribeInterface(DoneEvent{})
+}
+
+func TestDeliveryTimeout(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	var (
+		wedged = mux.SubscribeWithOptions(SubscribeOptions{DeliveryTimeout: 20 * time.Millisecond}, DoneEvent{})
+		live   = mux.SubscribeWithOptions(SubscribeOptions{QueueSize: 2}, DoneEvent{})
+	)
+	defer live.Unsubscribe()
+
+	// The wedged subscriber never reads, Post must still return.
+	for i := 0; i < 2; i++ {
+		if err := mux.Post(DoneEvent{}); err != nil {
+			t.Fatalf("Post return unexpected error: %v", err)
+		}
+	}
+	if err := wedged.Err(); err != ErrDeliveryTimeout {
+		t.Errorf("Got: %v, expected error: %v", err, ErrDeliveryTimeout)
+	}
+	if _, isOpen := <-wedged.Chan(); isOpen {
+		t.Errorf("Evicted subscription channel was not closed")
+	}
+	if n := len(live.Chan()); n != 2 {
+		t.Errorf("live subscriber got %d events, expected 2", n)
+	}
+	if err := live.Err(); err != nil {
+		t.Errorf("live subscriber got unexpected error: %v", err)
+	}
+}
+
+func TestParallelPost(t *testing.T) {
+	mux := NewTypeMux(TypeMuxConfig{Parallel: true})
+	defer mux.Stop()
+
+	// The first subscriber only reads once the second one got the event,
+	// which deadlocks unless delivery happens concurrently.
+	var (
+		first    = mux.Subscribe(ChainHeadEvent{})
+		second   = mux.Subscribe(ChainHeadEvent{})
+		received = make(chan struct{})
+		done     = make(chan struct{})
+	)
+	go func() {
+		for i := uint64(0); i < 10; i++ {
+			mux.Post(ChainHeadEvent{Number: i})
+		}
+		close(done)
+	}()
+	for want := uint64(0); want < 10; want++ {
+		go func() {
+			<-second.Chan()
+			received <- struct{}{}
+		}()
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatal("event was not delivered in parallel")
+		}
+		// Per-subscriber ordering is preserved.
+		if ev := <-first.Chan(); ev.Data.(ChainHeadEvent).Number != want {
+			t.Errorf("Got event %d, expected %d", ev.Data.(ChainHeadEvent).Number, want)
+		}
+	}
+	<-done
+}
+
+func TestStopWaitsForPost(t *testing.T) {
+	mux := NewTypeMux(TypeMuxConfig{Parallel: true})
+	mux.Subscribe(DoneEvent{})
+	mux.Subscribe(DoneEvent{})
+
+	posted := make(chan struct{})
+	go func() {
+		mux.Post(DoneEvent{})
+		close(posted)
+	}()
+	// Let Post block on the subscribers, then stop.
+	time.Sleep(20 * time.Millisecond)
+	mux.Stop()
+	select {
+	case <-posted:
+	default:
+		t.Errorf("Stop returned before in-flight Post")
+	}
+}
+
+func TestPostContext(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	var (
+		ready   = mux.SubscribeWithOptions(SubscribeOptions{QueueSize: 1}, DoneEvent{})
+		blocked = mux.Subscribe(DoneEvent{})
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	n, err := mux.PostContext(ctx, DoneEvent{})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Got: %v, expected error: %v", err, context.DeadlineExceeded)
+	}
+	if n != 1 {
+		t.Errorf("Got %d receivers, expected 1", n)
+	}
+	if len(ready.Chan()) != 1 {
+		t.Errorf("ready subscriber did not receive the event")
+	}
+	// The aborted subscriber is still subscribed.
+	if err := blocked.Err(); err != nil {
+		t.Errorf("blocked subscriber got unexpected error: %v", err)
+	}
+
+	n, err = mux.PostContext(context.Background(), NewMinedBlockEvent{})
+	if n != 0 || err != nil {
+		t.Errorf("Got (%d, %v), expected (0, nil)", n, err)
+	}
+}
+
+func TestSubscribeContext(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := mux.SubscribeContext(ctx, DoneEvent{})
+	cancel()
+
+	select {
+	case _, isOpen := <-sub.Chan():
+		if isOpen {
+			t.Errorf("Got event, expected closed channel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Subscription channel was not closed after cancel")
+	}
+	if err := mux.Post(DoneEvent{}); err != nil {
+		t.Errorf("Post return unexpected error: %v", err)
+	}
+}
+
+func TestSubscribeFunc(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	odd := func(ev interface{}) bool { return ev.(ChainHeadEvent).Number%2 == 1 }
+	sub := mux.SubscribeFunc(odd, ChainHeadEvent{})
+
+	// Filtered events are never queued, so an unread subscriber does not
+	// block Post for them.
+	for i := uint64(0); i < 4; i += 2 {
+		if n, _ := mux.PostContext(context.Background(), ChainHeadEvent{Number: i}); n != 0 {
+			t.Errorf("filtered event %d delivered to %d subscribers", i, n)
+		}
+	}
+	go mux.Post(ChainHeadEvent{Number: 1})
+	if ev := <-sub.Chan(); ev.Data.(ChainHeadEvent).Number != 1 {
+		t.Errorf("Got %v, expected event 1", ev.Data)
+	}
+
+	// Swap the filter on the live subscription.
+	sub.SetFilter(func(ev interface{}) bool { return ev.(ChainHeadEvent).Number == 2 })
+	go func() {
+		mux.Post(ChainHeadEvent{Number: 3})
+		mux.Post(ChainHeadEvent{Number: 2})
+	}()
+	if ev := <-sub.Chan(); ev.Data.(ChainHeadEvent).Number != 2 {
+		t.Errorf("Got %v, expected event 2", ev.Data)
+	}
+
+	// Removing the filter accepts everything again.
+	sub.SetFilter(nil)
+	go mux.Post(ChainHeadEvent{Number: 3})
+	if ev := <-sub.Chan(); ev.Data.(ChainHeadEvent).Number != 3 {
+		t.Errorf("Got %v, expected event 3", ev.Data)
+	}
+}
+
+func TestStopGraceful(t *testing.T) {
+	var mux TypeMux
+	var (
+		queued  = mux.SubscribeWithOptions(SubscribeOptions{QueueSize: 2}, DoneEvent{})
+		blocked = mux.Subscribe(DoneEvent{})
+	)
+	posted := make(chan error)
+	go func() { posted <- mux.Post(DoneEvent{}) }()
+	// Wait until Post has queued the event and blocks on the second subscriber.
+	for len(queued.Chan()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	stopped := make(chan error)
+	go func() { stopped <- mux.StopGraceful(context.Background()) }()
+
+	// Wait for the mux to start draining, new posts are rejected.
+	for mux.Post(NewMinedBlockEvent{}) != ErrMuxClosed {
+		time.Sleep(time.Millisecond)
+	}
+	// The in-flight event is still delivered, then the queue drained.
+	if ev, isOpen := <-blocked.Chan(); !isOpen || ev.Data != (DoneEvent{}) {
+		t.Errorf("in-flight event was not delivered")
+	}
+	if err := <-posted; err != nil {
+		t.Errorf("Post return unexpected error: %v", err)
+	}
+	select {
+	case <-stopped:
+		t.Fatal("StopGraceful returned before queue was drained")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if ev, isOpen := <-queued.Chan(); !isOpen || ev.Data != (DoneEvent{}) {
+		t.Errorf("queued event was not delivered")
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("StopGraceful return unexpected error: %v", err)
+	}
+	if _, isOpen := <-queued.Chan(); isOpen {
+		t.Errorf("Subscription channel was not closed")
+	}
+}
+
+func TestStopGracefulDeadline(t *testing.T) {
+	var mux TypeMux
+	sub := mux.SubscribeWithOptions(SubscribeOptions{QueueSize: 1}, DoneEvent{})
+	mux.Post(DoneEvent{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := mux.StopGraceful(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Got: %v, expected error: %v", err, context.DeadlineExceeded)
+	}
+	// The subscription is closed even though its queue was never read.
+	for range sub.Chan() {
+	}
+}
+
+func TestStopGracefulReplay(t *testing.T) {
+	mux := NewTypeMux(TypeMuxConfig{History: 3})
+	for i := 1; i <= 3; i++ {
+		mux.Post(ChainHeadEvent{Number: uint64(i)})
+	}
+	sub := mux.SubscribeWithReplay(3, ChainHeadEvent{})
+
+	stopped := make(chan error)
+	go func() { stopped <- mux.StopGraceful(context.Background()) }()
+	select {
+	case <-stopped:
+		t.Fatal("StopGraceful returned before the history was replayed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// All replayed events are delivered before the channel is closed.
+	var got []uint64
+	for ev := range sub.Chan() {
+		got = append(got, ev.Data.(ChainHeadEvent).Number)
+	}
+	if len(got) != 3 {
+		t.Errorf("Got events %v, expected all 3 replayed", got)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("StopGraceful return unexpected error: %v", err)
+	}
+}
+
+func TestStopGracefulClock(t *testing.T) {
+	clock := new(mclock.Simulated)
+	mux := NewTypeMux(TypeMuxConfig{Clock: clock})
+	sub := mux.SubscribeWithOptions(SubscribeOptions{QueueSize: 1}, DoneEvent{})
+	mux.Post(DoneEvent{})
+
+	stopped := make(chan error)
+	go func() { stopped <- mux.StopGraceful(context.Background()) }()
+	clock.WaitForTimers(1)
+	<-sub.Chan()
+
+	// The queue is only checked again when the mux clock advances.
+	select {
+	case <-stopped:
+		t.Fatal("StopGraceful returned without the clock advancing")
+	case <-time.After(20 * time.Millisecond):
+	}
+	clock.Run(drainInterval)
+	if err := <-stopped; err != nil {
+		t.Errorf("StopGraceful return unexpected error: %v", err)
+	}
+}
+
+func TestSimulatedClock(t *testing.T) {
+	clock := new(mclock.Simulated)
+	mux := NewTypeMux(TypeMuxConfig{Clock: clock})
+	defer mux.Stop()
+
+	sub := mux.SubscribeWithOptions(SubscribeOptions{DeliveryTimeout: time.Second}, DoneEvent{})
+	clock.Run(5 * time.Second)
+
+	posted := make(chan error)
+	before := time.Now()
+	go func() { posted <- mux.Post(DoneEvent{}) }()
+	ev := <-sub.Chan()
+	// Events are stamped with the wall clock, not the simulated one.
+	if ev.Time.Before(before) || ev.Time.After(time.Now()) {
+		t.Errorf("Got event time %v, expected wall clock time after %v", ev.Time, before)
+	}
+	if ev.Seq != 1 {
+		t.Errorf("Got event sequence %d, expected 1", ev.Seq)
+	}
+	<-posted
+
+	// The delivery timeout only expires when the simulated clock advances.
+	go func() { posted <- mux.Post(DoneEvent{}) }()
+	clock.WaitForTimers(1)
+	select {
+	case <-posted:
+		t.Fatal("Post returned before the delivery timeout")
+	default:
+	}
+	clock.Run(time.Second)
+	if err := <-posted; err != nil {
+		t.Errorf("Post return unexpected error: %v", err)
+	}
+	if err := sub.Err(); err != ErrDeliveryTimeout {
+		t.Errorf("Got: %v, expected error: %v", err, ErrDeliveryTimeout)
+	}
+}
+
+func TestStaleEvent(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	mux.Post(DoneEvent{})
+	stale := &TypeMuxEvent{Time: time.Now(), Seq: mux.seq.Load(), Data: DoneEvent{}}
+
+	// Created after the stale event was posted, even though its timestamp
+	// may be the same or later.
+	sub := mux.SubscribeWithOptions(SubscribeOptions{QueueSize: 1}, DoneEvent{})
+	if sub.deliver(stale, nil) {
+		t.Errorf("stale event was delivered")
+	}
+	mux.Post(DoneEvent{})
+	if ev := <-sub.Chan(); ev.Seq != stale.Seq+1 {
+		t.Errorf("Got event sequence %d, expected %d", ev.Seq, stale.Seq+1)
+	}
+}
@@ -1,3 +1,5 @@
 module event
 
 go 1.23.2
+
+require github.com/ethereum/go-ethereum v1.14.11
@@ -0,0 +1,168 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package event
+
+import (
+	"reflect"
+	"sort"
+)
+
+// SubscribeWithReplay creates a subscription for events of the given types which
+// first receives the last n retained events of each type, in posting order, and
+// then the live events posted after it was created. Every event is delivered
+// exactly once.
+//
+// Events are only retained if the mux was created with TypeMuxConfig.History
+// set, and at most that many per type.
+func (mux *TypeMux) SubscribeWithReplay(n int, types ...interface{}) *TypeMuxSubscription {
+	sub := newsub(mux, SubscribeOptions{})
+	sub.replayed = make(chan struct{})
+
+	events := mux.registerReplay(sub, n, typesOf(types))
+	if len(events) == 0 {
+		close(sub.replayed)
+	} else {
+		sub.unreplayed.Store(int64(len(events)))
+		go sub.replay(events)
+	}
+	return sub
+}
+
+// registerReplay registers sub and returns the last n retained events of its
+// types. Doing both under the write lock ensures that each event is either
+// replayed or routed live.
+func (mux *TypeMux) registerReplay(sub *TypeMuxSubscription, n int, rtypes []reflect.Type) []*TypeMuxEvent {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	mux.register(sub, rtypes)
+	if mux.stopped {
+		return nil
+	}
+	return mux.recent(n, rtypes)
+}
+
+// record adds event to the history of its type.
+// note: callers must hold mux.mutex for reading
+func (mux *TypeMux) record(rtyp reflect.Type, event *TypeMuxEvent) {
+	mux.histMu.Lock()
+	defer mux.histMu.Unlock()
+
+	if mux.history == nil {
+		mux.history = make(map[reflect.Type]*eventRing)
+	}
+	ring := mux.history[rtyp]
+	if ring == nil {
+		ring = newEventRing(mux.config.History)
+		mux.history[rtyp] = ring
+	}
+	mux.histSeq++
+	ring.push(mux.histSeq, event)
+}
+
+// recent returns the last n retained events of the given types in posting order.
+// note: callers must hold mux.mutex
+func (mux *TypeMux) recent(n int, rtypes []reflect.Type) []*TypeMuxEvent {
+	var entries []ringEntry
+	for _, rtyp := range rtypes {
+		if ring := mux.history[rtyp]; ring != nil {
+			entries = append(entries, ring.last(n)...)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+
+	events := make([]*TypeMuxEvent, len(entries))
+	for i, e := range entries {
+		events[i] = e.event
+	}
+	return events
+}
+
+// replay delivers the history snapshot taken at subscription time, then
+// releases the live deliveries waiting in deliver.
+func (s *TypeMuxSubscription) replay(events []*TypeMuxEvent) {
+	defer close(s.replayed)
+	defer s.unreplayed.Store(0)
+
+	s.postMu.RLock()
+	var err error
+	for _, ev := range events {
+		if !s.accepts(ev) {
+			s.unreplayed.Add(-1)
+			continue
+		}
+		_, err = s.send(ev, nil)
+		s.unreplayed.Add(-1)
+		if err != nil {
+			break
+		}
+		select {
+		case <-s.closing:
+			s.postMu.RUnlock()
+			return
+		default:
+		}
+	}
+	s.postMu.RUnlock()
+
+	if err != nil {
+		s.evict(err)
+	}
+}
+
+type ringEntry struct {
+	seq   uint64
+	event *TypeMuxEvent
+}
+
+// eventRing is a fixed-size ring buffer of events.
+type eventRing struct {
+	entries []ringEntry
+	next    int // slot of the next push
+	full    bool
+}
+
+func newEventRing(size int) *eventRing {
+	return &eventRing{entries: make([]ringEntry, size)}
+}
+
+func (r *eventRing) push(seq uint64, event *TypeMuxEvent) {
+	r.entries[r.next] = ringEntry{seq, event}
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// last returns up to n of the most recent entries, oldest first.
+func (r *eventRing) last(n int) []ringEntry {
+	size := r.next
+	if r.full {
+		size = len(r.entries)
+	}
+	if n > size {
+		n = size
+	}
+	if n <= 0 {
+		return nil
+	}
+	out := make([]ringEntry, n)
+	start := r.next - n
+	for i := range out {
+		out[i] = r.entries[(start+i+len(r.entries))%len(r.entries)]
+	}
+	return out
+}
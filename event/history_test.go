@@ -0,0 +1,124 @@
+package event
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribeWithReplay(t *testing.T) {
+	mux := NewTypeMux(TypeMuxConfig{History: 3})
+	defer mux.Stop()
+
+	for i := uint64(1); i <= 5; i++ {
+		mux.Post(ChainHeadEvent{Number: i})
+		if i == 4 {
+			mux.Post(DoneEvent{})
+		}
+	}
+	sub := mux.SubscribeWithReplay(2, ChainHeadEvent{}, DoneEvent{})
+	defer sub.Unsubscribe()
+	go mux.Post(ChainHeadEvent{Number: 6})
+
+	// The last two events of each type, merged in posting order, then live.
+	want := []interface{}{ChainHeadEvent{Number: 4}, DoneEvent{}, ChainHeadEvent{Number: 5}, ChainHeadEvent{Number: 6}}
+	for i, w := range want {
+		if ev := <-sub.Chan(); ev.Data != w {
+			t.Errorf("event %d: got %v, expected %v", i, ev.Data, w)
+		}
+	}
+}
+
+func TestSubscribeWithReplayNoGaps(t *testing.T) {
+	const n = 1000
+	mux := NewTypeMux(TypeMuxConfig{History: n})
+	defer mux.Stop()
+
+	started := make(chan struct{})
+	go func() {
+		for i := uint64(0); i < n; i++ {
+			if i == n/2 {
+				close(started)
+			}
+			mux.Post(ChainHeadEvent{Number: i})
+		}
+	}()
+	<-started
+	sub := mux.SubscribeWithReplay(n, ChainHeadEvent{})
+	defer sub.Unsubscribe()
+
+	// Whatever the interleaving, the subscriber sees 0..n-1 exactly once.
+	for want := uint64(0); want < n; want++ {
+		ev := <-sub.Chan()
+		if got := ev.Data.(ChainHeadEvent).Number; got != want {
+			t.Fatalf("got event %d, expected %d", got, want)
+		}
+	}
+}
+
+func TestSubscribeWithReplayDisabled(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	mux.Post(DoneEvent{})
+	sub := mux.SubscribeWithReplay(1, DoneEvent{})
+	go func() {
+		mux.Post(DoneEvent{})
+		sub.Unsubscribe()
+	}()
+
+	var count int
+	for range sub.Chan() {
+		count++
+	}
+	if count != 1 {
+		t.Errorf("got %d events, expected only the live one", count)
+	}
+}
+
+func TestSubscribeWithReplayDuplicateType(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("SubscribeWithReplay did not panic for duplicate type")
+			}
+		}()
+		mux.SubscribeWithReplay(1, DoneEvent{}, DoneEvent{})
+	}()
+
+	// The mux must not stay locked after the panic.
+	posted := make(chan error, 1)
+	go func() { posted <- mux.Post(DoneEvent{}) }()
+	select {
+	case err := <-posted:
+		if err != nil {
+			t.Errorf("Post return unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Post blocked after SubscribeWithReplay panicked")
+	}
+}
+
+func TestEventRing(t *testing.T) {
+	r := newEventRing(3)
+	if got := r.last(2); len(got) != 0 {
+		t.Errorf("empty ring returned %d entries", len(got))
+	}
+	for seq := uint64(1); seq <= 4; seq++ {
+		r.push(seq, nil)
+	}
+	got := r.last(5)
+	if len(got) != 3 {
+		t.Fatalf("got %d entries, expected 3", len(got))
+	}
+	for i, e := range got {
+		if e.seq != uint64(i+2) {
+			t.Errorf("entry %d: got seq %d, expected %d", i, e.seq, i+2)
+		}
+	}
+	if got := r.last(1); len(got) != 1 || got[0].seq != 4 {
+		t.Errorf("last(1) returned %v, expected seq 4", got)
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package event
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Codec encodes event payloads for the journal.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+var (
+	// JSONCodec encodes payloads with encoding/json.
+	JSONCodec Codec = jsonCodec{}
+	// GobCodec encodes payloads with encoding/gob. Note that gob cannot encode
+	// structs without exported fields.
+	GobCodec Codec = gobCodec{}
+)
+
+var (
+	errJournalClosed  = errors.New("event: journal closed")
+	errJournalCorrupt = errors.New("event: journal record checksum mismatch")
+)
+
+const (
+	journalSuffix      = ".journal"
+	journalHeaderSize  = 8       // crc32 + body length
+	defaultSegmentSize = 8 << 20 // bytes
+)
+
+// Journal is an append-only, segmented log of posted events. Set it as
+// TypeMuxConfig.Journal to record everything a mux dispatches, and use Replay to
+// post the recorded sequence into another mux.
+//
+// Every record is written with a single write call. Each time a journal is
+// opened it starts a new segment file, and a failed write also ends the current
+// segment, so a torn record can only be found at the end of a segment.
+type Journal struct {
+	dir         string
+	codec       Codec
+	segmentSize int64
+
+	mu    sync.Mutex
+	file  journalFile
+	size  int64 // bytes written to the current segment
+	index int   // number of the current segment
+	types map[string]reflect.Type
+}
+
+// journalFile is the open segment of a journal.
+type journalFile interface {
+	io.Writer
+	Sync() error
+	Close() error
+}
+
+// OpenJournal opens the journal in dir, creating the directory if needed.
+// A new segment is started once the current one reaches segmentSize bytes;
+// zero selects a default of 8MB.
+func OpenJournal(dir string, codec Codec, segmentSize int64) (*Journal, error) {
+	if segmentSize <= 0 {
+		segmentSize = defaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	segments, err := journalSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{
+		dir:         dir,
+		codec:       codec,
+		segmentSize: segmentSize,
+		types:       make(map[string]reflect.Type),
+	}
+	if len(segments) > 0 {
+		j.index = segments[len(segments)-1]
+	}
+	if err := j.roll(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Register makes the types of the given sample values known to Replay, so their
+// payloads decode back into the original Go types. Types are identified by their
+// package path and name. Registering a different type under a name that is already
+// taken panics.
+func (j *Journal) Register(samples ...interface{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, sample := range samples {
+		rtyp := reflect.TypeOf(sample)
+		name := journalTypeName(rtyp)
+		if prev, ok := j.types[name]; ok && prev != rtyp {
+			panic(fmt.Sprintf("event: journal type name %s already registered for %v", name, prev))
+		}
+		j.types[name] = rtyp
+	}
+}
+
+// journalTypeName returns the name identifying rtyp in journal records, which
+// includes the package path of named types.
+func journalTypeName(rtyp reflect.Type) string {
+	if rtyp.Kind() == reflect.Pointer {
+		return "*" + journalTypeName(rtyp.Elem())
+	}
+	if rtyp.Name() == "" || rtyp.PkgPath() == "" {
+		return rtyp.String() // unnamed or predeclared type
+	}
+	return rtyp.PkgPath() + "." + rtyp.Name()
+}
+
+// Append writes ev to the journal.
+func (j *Journal) Append(ev *TypeMuxEvent) error {
+	if ev.Data == nil {
+		return errors.New("event: cannot journal nil event")
+	}
+	data, err := j.codec.Marshal(ev.Data)
+	if err != nil {
+		return fmt.Errorf("event: journal encoding failed: %v", err)
+	}
+	name := journalTypeName(reflect.TypeOf(ev.Data))
+
+	// Assemble the record: crc32 | length | time | name length | name | data.
+	rec := make([]byte, journalHeaderSize+8+2+len(name)+len(data))
+	body := rec[journalHeaderSize:]
+	binary.BigEndian.PutUint64(body, uint64(ev.Time.UnixNano()))
+	binary.BigEndian.PutUint16(body[8:], uint16(len(name)))
+	copy(body[10:], name)
+	copy(body[10+len(name):], data)
+	binary.BigEndian.PutUint32(rec, crc32.ChecksumIEEE(body))
+	binary.BigEndian.PutUint32(rec[4:], uint32(len(body)))
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return errJournalClosed
+	}
+	if j.size > 0 && j.size+int64(len(rec)) > j.segmentSize {
+		if err := j.roll(); err != nil {
+			return err
+		}
+	}
+	n, err := j.file.Write(rec)
+	j.size += int64(n)
+	if err != nil && n > 0 {
+		// Don't append after a torn record, it must stay at the end of its segment.
+		if rerr := j.roll(); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+	}
+	return err
+}
+
+// Sync commits the current segment to stable storage.
+func (j *Journal) Sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return errJournalClosed
+	}
+	return j.file.Sync()
+}
+
+// Close syncs and closes the journal. Later appends fail.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Sync()
+	if cerr := j.file.Close(); err == nil {
+		err = cerr
+	}
+	j.file = nil
+	return err
+}
+
+// roll closes the current segment and starts the next one.
+// note: callers must hold j.mu
+func (j *Journal) roll() error {
+	if j.file != nil {
+		if err := j.file.Close(); err != nil {
+			return err
+		}
+	}
+	j.index++
+	f, err := os.OpenFile(j.segmentPath(j.index), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	j.file, j.size = f, 0
+	return nil
+}
+
+func (j *Journal) segmentPath(index int) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%06d%s", index, journalSuffix))
+}
+
+// Replay posts all journaled events, oldest first, to mux and returns how many
+// were posted. The original timestamps are not preserved. Replaying into a mux
+// that writes to the same journal is not supported.
+func (j *Journal) Replay(mux *TypeMux) (int, error) {
+	j.mu.Lock()
+	segments, err := journalSegments(j.dir)
+	j.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, index := range segments {
+		err := j.replaySegment(j.segmentPath(index), func(ev *TypeMuxEvent) error {
+			if err := mux.Post(ev.Data); err != nil {
+				return err
+			}
+			n++
+			return nil
+		})
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// replaySegment decodes the records of a segment file and passes them to fn.
+// A truncated record at the end of the file is ignored.
+func (j *Journal) replaySegment(path string, fn func(*TypeMuxEvent) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for len(data) > 0 {
+		if len(data) < journalHeaderSize {
+			return nil // torn header
+		}
+		size := int(binary.BigEndian.Uint32(data[4:]))
+		if len(data) < journalHeaderSize+size {
+			return nil // torn body
+		}
+		body := data[journalHeaderSize : journalHeaderSize+size]
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data) {
+			return fmt.Errorf("%w in %s", errJournalCorrupt, path)
+		}
+		data = data[journalHeaderSize+size:]
+
+		ev, err := j.decode(body)
+		if err != nil {
+			return err
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *Journal) decode(body []byte) (*TypeMuxEvent, error) {
+	if len(body) < 10 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	nano := int64(binary.BigEndian.Uint64(body))
+	namelen := int(binary.BigEndian.Uint16(body[8:]))
+	if len(body) < 10+namelen {
+		return nil, io.ErrUnexpectedEOF
+	}
+	name := string(body[10 : 10+namelen])
+
+	j.mu.Lock()
+	rtyp, ok := j.types[name]
+	j.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("event: journal type %s is not registered", name)
+	}
+	// Decode into a fresh value of the registered type. Pointer types are
+	// decoded into their element and kept as a pointer.
+	var val reflect.Value
+	if rtyp.Kind() == reflect.Pointer {
+		val = reflect.New(rtyp.Elem())
+	} else {
+		val = reflect.New(rtyp)
+	}
+	if err := j.codec.Unmarshal(body[10+namelen:], val.Interface()); err != nil {
+		return nil, fmt.Errorf("event: journal decoding %s failed: %v", name, err)
+	}
+	if rtyp.Kind() != reflect.Pointer {
+		val = val.Elem()
+	}
+	return &TypeMuxEvent{Time: time.Unix(0, nano), Data: val.Interface()}, nil
+}
+
+// journalSegments returns the segment numbers found in dir in ascending order.
+func journalSegments(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []int
+	for _, entry := range entries {
+		var index int
+		if _, err := fmt.Sscanf(entry.Name(), "%06d"+journalSuffix, &index); err == nil {
+			segments = append(segments, index)
+		}
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
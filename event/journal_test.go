@@ -0,0 +1,228 @@
+package event
+
+import (
+	"errors"
+	htmltemplate "html/template"
+	"os"
+	"reflect"
+	"testing"
+	"text/template"
+)
+
+// collect subscribes to the given types and returns a function that waits
+// for n events and returns their payloads.
+func collect(mux *TypeMux, n int, types ...interface{}) func() []interface{} {
+	sub := mux.SubscribeWithOptions(SubscribeOptions{QueueSize: n}, types...)
+	return func() []interface{} {
+		defer sub.Unsubscribe()
+		got := make([]interface{}, 0, n)
+		for len(got) < n {
+			got = append(got, (<-sub.Chan()).Data)
+		}
+		return got
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := OpenJournal(dir, JSONCodec, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posted := []interface{}{ChainHeadEvent{Number: 1}, DoneEvent{}, &ChainHeadEvent{Number: 2}, ChainHeadEvent{Number: 3}}
+
+	mux := NewTypeMux(TypeMuxConfig{Journal: journal})
+	for _, ev := range posted {
+		if err := mux.Post(ev); err != nil {
+			t.Fatalf("Post return unexpected error: %v", err)
+		}
+	}
+	mux.Stop()
+	if err := journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The small segment size forces a new segment per record.
+	if segments, _ := journalSegments(dir); len(segments) != len(posted) {
+		t.Errorf("got %d segments, expected %d", len(segments), len(posted))
+	}
+
+	// Reopen the journal as after a restart and replay it into a fresh mux.
+	journal, err = OpenJournal(dir, JSONCodec, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	journal.Register(ChainHeadEvent{}, &ChainHeadEvent{}, DoneEvent{})
+
+	fresh := new(TypeMux)
+	defer fresh.Stop()
+	wait := collect(fresh, len(posted), ChainHeadEvent{}, &ChainHeadEvent{}, DoneEvent{})
+	n, err := journal.Replay(fresh)
+	if err != nil {
+		t.Fatalf("Replay return unexpected error: %v", err)
+	}
+	if n != len(posted) {
+		t.Errorf("replayed %d events, expected %d", n, len(posted))
+	}
+	if got := wait(); !reflect.DeepEqual(got, posted) {
+		t.Errorf("replayed %v, expected %v", got, posted)
+	}
+}
+
+func TestJournalGob(t *testing.T) {
+	journal, err := OpenJournal(t.TempDir(), GobCodec, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	journal.Register(ChainHeadEvent{})
+
+	mux := NewTypeMux(TypeMuxConfig{Journal: journal})
+	mux.Post(ChainHeadEvent{Number: 7})
+	mux.Stop()
+
+	fresh := new(TypeMux)
+	defer fresh.Stop()
+	wait := collect(fresh, 1, ChainHeadEvent{})
+	if _, err := journal.Replay(fresh); err != nil {
+		t.Fatalf("Replay return unexpected error: %v", err)
+	}
+	if got := wait(); got[0] != (ChainHeadEvent{Number: 7}) {
+		t.Errorf("replayed %v, expected %v", got[0], ChainHeadEvent{Number: 7})
+	}
+}
+
+func TestJournalTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := OpenJournal(dir, JSONCodec, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.Register(ChainHeadEvent{})
+	mux := NewTypeMux(TypeMuxConfig{Journal: journal})
+	mux.Post(ChainHeadEvent{Number: 1})
+	mux.Post(ChainHeadEvent{Number: 2})
+	mux.Stop()
+	journal.Close()
+
+	// Simulate a crash in the middle of writing the second record.
+	path := journal.segmentPath(1)
+	info, _ := os.Stat(path)
+	if err := os.Truncate(path, info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+	fresh := new(TypeMux)
+	defer fresh.Stop()
+	if n, err := journal.Replay(fresh); n != 1 || err != nil {
+		t.Errorf("Replay returned (%d, %v), expected (1, nil)", n, err)
+	}
+
+	// A record with a bad checksum is reported.
+	data, _ := os.ReadFile(path)
+	data[len(data)/3] ^= 0xff
+	os.WriteFile(path, data, 0644)
+	if _, err := journal.Replay(fresh); err == nil {
+		t.Errorf("Replay did not report corrupt record")
+	}
+}
+
+// shortWriter writes half of the first record, then fails.
+type shortWriter struct {
+	journalFile
+	failed bool
+}
+
+func (w *shortWriter) Write(b []byte) (int, error) {
+	if w.failed {
+		return w.journalFile.Write(b)
+	}
+	w.failed = true
+	n, _ := w.journalFile.Write(b[:len(b)/2])
+	return n, errors.New("disk full")
+}
+
+func TestJournalShortWrite(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := OpenJournal(dir, JSONCodec, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.Register(ChainHeadEvent{})
+	mux := NewTypeMux(TypeMuxConfig{Journal: journal})
+	mux.Post(ChainHeadEvent{Number: 1})
+	journal.file = &shortWriter{journalFile: journal.file}
+	if err := mux.Post(ChainHeadEvent{Number: 2}); err == nil {
+		t.Errorf("Post did not fail on short write")
+	}
+	// The torn record ends its segment, later records go to a new one.
+	mux.Post(ChainHeadEvent{Number: 3})
+	mux.Stop()
+	journal.Close()
+
+	fresh := new(TypeMux)
+	defer fresh.Stop()
+	wait := collect(fresh, 2, ChainHeadEvent{})
+	if n, err := journal.Replay(fresh); n != 2 || err != nil {
+		t.Fatalf("Replay returned (%d, %v), expected (2, nil)", n, err)
+	}
+	want := []interface{}{ChainHeadEvent{Number: 1}, ChainHeadEvent{Number: 3}}
+	if got := wait(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v, expected %v", got, want)
+	}
+}
+
+func TestJournalTypeNames(t *testing.T) {
+	journal, err := OpenJournal(t.TempDir(), JSONCodec, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	// Types with the same short name in different packages are told apart.
+	text, html := reflect.TypeOf(template.Template{}), reflect.TypeOf(htmltemplate.Template{})
+	if text.String() != html.String() || journalTypeName(text) == journalTypeName(html) {
+		t.Errorf("Got names %q and %q, expected distinct names", journalTypeName(text), journalTypeName(html))
+	}
+	journal.Register(template.Template{}, htmltemplate.Template{}, DoneEvent{})
+
+	// Registering another type under a taken name panics.
+	type DoneEvent struct{ X int }
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register did not panic for conflicting type")
+		}
+	}()
+	journal.Register(DoneEvent{})
+}
+
+func TestJournalUnregisteredType(t *testing.T) {
+	journal, err := OpenJournal(t.TempDir(), JSONCodec, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	mux := NewTypeMux(TypeMuxConfig{Journal: journal})
+	mux.Post(DoneEvent{})
+	mux.Stop()
+
+	fresh := new(TypeMux)
+	defer fresh.Stop()
+	if _, err := journal.Replay(fresh); err == nil {
+		t.Errorf("Replay did not fail for unregistered type")
+	}
+}
+
+func TestJournalClosed(t *testing.T) {
+	journal, err := OpenJournal(t.TempDir(), JSONCodec, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	mux := NewTypeMux(TypeMuxConfig{Journal: journal})
+	defer mux.Stop()
+	if err := mux.Post(DoneEvent{}); err != errJournalClosed {
+		t.Errorf("Got: %v, expected error: %v", err, errJournalClosed)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package event
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LeakKind describes why a subscription was reported by a LeakDetector.
+type LeakKind int
+
+const (
+	// LeakLive is reported for subscriptions still live when their mux is stopped.
+	LeakLive LeakKind = iota
+	// LeakAge is reported for subscriptions live for longer than LeakConfig.MaxAge.
+	LeakAge
+	// LeakBlocked is reported for subscribers that have kept Post waiting for
+	// longer than LeakConfig.MaxBlocked.
+	LeakBlocked
+)
+
+func (k LeakKind) String() string {
+	switch k {
+	case LeakLive:
+		return "live at stop"
+	case LeakAge:
+		return "old subscription"
+	case LeakBlocked:
+		return "blocked subscriber"
+	default:
+		return fmt.Sprintf("LeakKind(%d)", int(k))
+	}
+}
+
+// LeakReport describes a suspicious subscription.
+type LeakReport struct {
+	Kind     LeakKind
+	Created  time.Time     // when the subscription was created
+	Duration time.Duration // age of the subscription, or how long it has been blocking
+	Stack    string        // stack trace of the Subscribe call
+}
+
+func (r LeakReport) String() string {
+	return fmt.Sprintf("event: %v after %v, subscribed at:\n%s", r.Kind, r.Duration, r.Stack)
+}
+
+// LeakConfig configures a LeakDetector.
+type LeakConfig struct {
+	MaxAge     time.Duration    // report subscriptions older than this, zero disables
+	MaxBlocked time.Duration    // report subscribers blocking longer than this, zero disables
+	Interval   time.Duration    // how often to check, defaults to one second
+	Report     func(LeakReport) // receives reports, defaults to logging them with slog
+}
+
+// LeakDetector is a debugging aid that tracks subscriptions and reports those
+// that look leaked. It records the creation stack of every subscription made on
+// a TypeMux configured with it, and reports subscriptions that are still live
+// when the mux is stopped, that exceed a maximum age, or that keep Post blocked
+// for too long. Each subscription is reported at most once per kind, blocking
+// reports once per blocked delivery.
+//
+// A detector may be shared by several muxes. Tracking costs a stack trace per
+// subscription, so it should not be enabled in production.
+type LeakDetector struct {
+	config LeakConfig
+	mu     sync.Mutex
+	subs   map[*leakEntry]struct{}
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// leakEntry is the tracking state of a single subscription.
+type leakEntry struct {
+	detector *LeakDetector
+	created  time.Time
+	stack    string
+	blocked  atomic.Int64 // unix nanoseconds when the current send started blocking, 0 if not blocked
+
+	// guarded by detector.mu
+	agedOut     bool
+	reportedFor int64 // value of blocked that was already reported
+}
+
+// NewLeakDetector creates a detector and starts its background checks.
+// Call Stop to release it.
+func NewLeakDetector(config LeakConfig) *LeakDetector {
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.Report == nil {
+		config.Report = func(r LeakReport) {
+			slog.Warn("Possible subscription leak", "kind", r.Kind, "duration", r.Duration, "created", r.Created, "stack", r.Stack)
+		}
+	}
+	d := &LeakDetector{
+		config: config,
+		subs:   make(map[*leakEntry]struct{}),
+		quit:   make(chan struct{}),
+	}
+	d.wg.Add(1)
+	go d.loop()
+	return d
+}
+
+// Stop terminates the background checks.
+func (d *LeakDetector) Stop() {
+	close(d.quit)
+	d.wg.Wait()
+}
+
+// Live returns the number of tracked subscriptions.
+func (d *LeakDetector) Live() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.subs)
+}
+
+func (d *LeakDetector) loop() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			d.check(now)
+		case <-d.quit:
+			return
+		}
+	}
+}
+
+// check reports the tracked subscriptions exceeding the configured limits.
+func (d *LeakDetector) check(now time.Time) {
+	var reports []LeakReport
+	d.mu.Lock()
+	for e := range d.subs {
+		if age := now.Sub(e.created); d.config.MaxAge > 0 && !e.agedOut && age > d.config.MaxAge {
+			e.agedOut = true
+			reports = append(reports, e.report(LeakAge, age))
+		}
+		since := e.blocked.Load()
+		if blocked := now.Sub(time.Unix(0, since)); d.config.MaxBlocked > 0 && since != 0 && since != e.reportedFor && blocked > d.config.MaxBlocked {
+			e.reportedFor = since
+			reports = append(reports, e.report(LeakBlocked, blocked))
+		}
+	}
+	d.mu.Unlock()
+
+	for _, r := range reports {
+		d.config.Report(r)
+	}
+}
+
+// track starts tracking a subscription created by the caller.
+func (d *LeakDetector) track() *leakEntry {
+	e := &leakEntry{detector: d, created: time.Now(), stack: string(debug.Stack())}
+	d.mu.Lock()
+	d.subs[e] = struct{}{}
+	d.mu.Unlock()
+	return e
+}
+
+// untrack stops tracking a subscription that has ended.
+func (e *leakEntry) untrack() {
+	e.detector.mu.Lock()
+	delete(e.detector.subs, e)
+	e.detector.mu.Unlock()
+}
+
+// live reports the subscription if it is still tracked.
+func (e *leakEntry) live() {
+	e.detector.mu.Lock()
+	_, ok := e.detector.subs[e]
+	e.detector.mu.Unlock()
+	if ok {
+		e.detector.config.Report(e.report(LeakLive, time.Since(e.created)))
+	}
+}
+
+// blocking marks the start and end of a send that may block. Marking an
+// already blocked subscription keeps the original start time.
+func (e *leakEntry) blocking(blocked bool) {
+	if blocked {
+		e.blocked.CompareAndSwap(0, time.Now().UnixNano())
+	} else {
+		e.blocked.Store(0)
+	}
+}
+
+func (e *leakEntry) report(kind LeakKind, d time.Duration) LeakReport {
+	return LeakReport{Kind: kind, Created: e.created, Duration: d, Stack: e.stack}
+}
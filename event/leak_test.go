@@ -0,0 +1,91 @@
+package event
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDetector(config LeakConfig) (*LeakDetector, chan LeakReport) {
+	reports := make(chan LeakReport, 10)
+	config.Report = func(r LeakReport) { reports <- r }
+	return NewLeakDetector(config), reports
+}
+
+func TestLeakDetectorLive(t *testing.T) {
+	detector, reports := newTestDetector(LeakConfig{})
+	defer detector.Stop()
+
+	mux := NewTypeMux(TypeMuxConfig{LeakDetector: detector})
+	mux.Subscribe(DoneEvent{}).Unsubscribe()
+	mux.Subscribe(DoneEvent{}, NewMinedBlockEvent{}) // leaked
+	if n := detector.Live(); n != 1 {
+		t.Errorf("Got %d live subscriptions, expected 1", n)
+	}
+	mux.Stop()
+
+	select {
+	case r := <-reports:
+		if r.Kind != LeakLive {
+			t.Errorf("Got report kind %v, expected %v", r.Kind, LeakLive)
+		}
+		if !strings.Contains(r.Stack, "TestLeakDetectorLive") {
+			t.Errorf("Report stack does not contain the subscribing function:\n%s", r.Stack)
+		}
+	default:
+		t.Fatal("No report for leaked subscription")
+	}
+	select {
+	case r := <-reports:
+		t.Errorf("Unexpected report: %v", r)
+	default:
+	}
+	if n := detector.Live(); n != 0 {
+		t.Errorf("Got %d live subscriptions after stop, expected 0", n)
+	}
+}
+
+func TestLeakDetectorAge(t *testing.T) {
+	detector, reports := newTestDetector(LeakConfig{MaxAge: 20 * time.Millisecond, Interval: 5 * time.Millisecond})
+	defer detector.Stop()
+
+	mux := NewTypeMux(TypeMuxConfig{LeakDetector: detector})
+	sub := mux.Subscribe(DoneEvent{})
+	defer sub.Unsubscribe()
+
+	select {
+	case r := <-reports:
+		if r.Kind != LeakAge || r.Duration < 20*time.Millisecond {
+			t.Errorf("Got report %v after %v, expected %v", r.Kind, r.Duration, LeakAge)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No report for old subscription")
+	}
+	// Subscriptions are reported only once.
+	select {
+	case r := <-reports:
+		t.Errorf("Unexpected report: %v", r)
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+func TestLeakDetectorBlocked(t *testing.T) {
+	detector, reports := newTestDetector(LeakConfig{MaxBlocked: 20 * time.Millisecond, Interval: 5 * time.Millisecond})
+	defer detector.Stop()
+
+	mux := NewTypeMux(TypeMuxConfig{LeakDetector: detector})
+	defer mux.Stop()
+	sub := mux.Subscribe(DoneEvent{})
+	go mux.Post(DoneEvent{})
+
+	select {
+	case r := <-reports:
+		if r.Kind != LeakBlocked || r.Duration < 20*time.Millisecond {
+			t.Errorf("Got report %v after %v, expected %v", r.Kind, r.Duration, LeakBlocked)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No report for blocked subscriber")
+	}
+	<-sub.Chan()
+	sub.Unsubscribe()
+}
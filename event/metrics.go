@@ -0,0 +1,263 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package event
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// histogramBounds are the upper bounds of the latency histogram buckets.
+var histogramBounds = []time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// histogram counts durations in the buckets given by histogramBounds.
+type histogram struct {
+	mu     sync.Mutex
+	counts [9]uint64 // one per bound, plus one for larger values
+	count  uint64
+	sum    time.Duration
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := sort.Search(len(histogramBounds), func(i int) bool { return d <= histogramBounds[i] })
+	h.mu.Lock()
+	h.counts[i]++
+	h.count++
+	h.sum += d
+	h.mu.Unlock()
+}
+
+func (h *histogram) snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := HistogramSnapshot{Count: h.count, Sum: h.sum, Buckets: make([]Bucket, len(histogramBounds))}
+	var cumulative uint64
+	for i, bound := range histogramBounds {
+		cumulative += h.counts[i]
+		s.Buckets[i] = Bucket{UpperBound: bound, Count: cumulative}
+	}
+	return s
+}
+
+// muxMetrics holds the per-type counters of a TypeMux.
+type muxMetrics struct {
+	mu    sync.Mutex
+	types map[reflect.Type]*typeMetrics
+}
+
+type typeMetrics struct {
+	posts   atomic.Uint64
+	stale   atomic.Uint64
+	latency histogram
+}
+
+func (m *muxMetrics) get(rtyp reflect.Type) *typeMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tm := m.types[rtyp]
+	if tm == nil {
+		tm = new(typeMetrics)
+		m.types[rtyp] = tm
+	}
+	return tm
+}
+
+// subMetrics holds the counters of a single subscription.
+type subMetrics struct {
+	delivered atomic.Uint64
+	blocked   histogram
+}
+
+// HistogramSnapshot is a point-in-time copy of a duration histogram.
+type HistogramSnapshot struct {
+	Buckets []Bucket      `json:"buckets"`
+	Count   uint64        `json:"count"`
+	Sum     time.Duration `json:"sum"`
+}
+
+// Bucket is a cumulative histogram bucket: Count observations were less than
+// or equal to UpperBound.
+type Bucket struct {
+	UpperBound time.Duration `json:"le"`
+	Count      uint64        `json:"count"`
+}
+
+// TypeMetrics are the metrics of one event type.
+type TypeMetrics struct {
+	Posts       uint64            `json:"posts"`       // events posted
+	Subscribers int               `json:"subscribers"` // current exact-type subscriptions
+	Stale       uint64            `json:"stale"`       // deliveries skipped as stale
+	Latency     HistogramSnapshot `json:"latency"`     // time from Post to delivery
+}
+
+// SubscriptionMetrics are the metrics of one subscription.
+type SubscriptionMetrics struct {
+	ID        uint64            `json:"id"`
+	Types     []string          `json:"types"`     // registered types, "*" for taps
+	Delivered uint64            `json:"delivered"` // events accepted by the subscriber
+	Dropped   uint64            `json:"dropped"`   // events lost to the overflow policy
+	Blocked   HistogramSnapshot `json:"blocked"`   // time Post spent handing over events
+}
+
+// MetricsSnapshot is a point-in-time copy of the metrics of a TypeMux. Its
+// String method returns JSON, so it can be published with expvar.Func.
+type MetricsSnapshot struct {
+	Types         map[string]TypeMetrics `json:"types"`
+	Subscriptions []SubscriptionMetrics  `json:"subscriptions"`
+}
+
+// Metrics returns the current metrics of the mux. Metrics are only collected if
+// the mux was created with TypeMuxConfig.Metrics set; otherwise the snapshot
+// is empty.
+func (mux *TypeMux) Metrics() MetricsSnapshot {
+	snap := MetricsSnapshot{Types: make(map[string]TypeMetrics)}
+	if mux.stats == nil {
+		return snap
+	}
+	mux.stats.mu.Lock()
+	for rtyp, tm := range mux.stats.types {
+		snap.Types[typeName(rtyp)] = TypeMetrics{
+			Posts:   tm.posts.Load(),
+			Stale:   tm.stale.Load(),
+			Latency: tm.latency.snapshot(),
+		}
+	}
+	mux.stats.mu.Unlock()
+
+	mux.mutex.RLock()
+	types := make(map[*TypeMuxSubscription][]string)
+	for _, m := range []map[reflect.Type][]*TypeMuxSubscription{mux.subm, mux.ifacem} {
+		for rtyp, subs := range m {
+			name := typeName(rtyp)
+			tm := snap.Types[name]
+			tm.Subscribers = len(subs)
+			snap.Types[name] = tm
+			for _, sub := range subs {
+				types[sub] = append(types[sub], name)
+			}
+		}
+	}
+	for _, sub := range mux.taps {
+		types[sub] = []string{"*"}
+	}
+	mux.mutex.RUnlock()
+
+	for sub, names := range types {
+		sort.Strings(names)
+		snap.Subscriptions = append(snap.Subscriptions, SubscriptionMetrics{
+			ID:        sub.id,
+			Types:     names,
+			Delivered: sub.stats.delivered.Load(),
+			Dropped:   sub.Dropped(),
+			Blocked:   sub.stats.blocked.snapshot(),
+		})
+	}
+	sort.Slice(snap.Subscriptions, func(i, j int) bool { return snap.Subscriptions[i].ID < snap.Subscriptions[j].ID })
+	return snap
+}
+
+func typeName(rtyp reflect.Type) string {
+	if rtyp == nil {
+		return "nil"
+	}
+	return rtyp.String()
+}
+
+// String returns the snapshot as JSON.
+func (s MetricsSnapshot) String() string {
+	blob, err := json.Marshal(s)
+	if err != nil {
+		return "{}"
+	}
+	return string(blob)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus writes the snapshot in the Prometheus text exposition format.
+func (s MetricsSnapshot) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	names := make([]string, 0, len(s.Types))
+	for name := range s.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	typeLabel := func(name string) string { return `type="` + labelEscaper.Replace(name) + `"` }
+	subLabel := func(sub SubscriptionMetrics) string { return `sub="` + strconv.FormatUint(sub.ID, 10) + `"` }
+
+	header(bw, "typemux_posts_total", "counter", "Number of events posted, by type.")
+	for _, name := range names {
+		fmt.Fprintf(bw, "typemux_posts_total{%s} %d\n", typeLabel(name), s.Types[name].Posts)
+	}
+	header(bw, "typemux_subscribers", "gauge", "Number of subscriptions, by type.")
+	for _, name := range names {
+		fmt.Fprintf(bw, "typemux_subscribers{%s} %d\n", typeLabel(name), s.Types[name].Subscribers)
+	}
+	header(bw, "typemux_stale_total", "counter", "Number of deliveries skipped as stale, by type.")
+	for _, name := range names {
+		fmt.Fprintf(bw, "typemux_stale_total{%s} %d\n", typeLabel(name), s.Types[name].Stale)
+	}
+	header(bw, "typemux_delivery_latency_seconds", "histogram", "Time from Post to delivery, by type.")
+	for _, name := range names {
+		writeHistogram(bw, "typemux_delivery_latency_seconds", typeLabel(name), s.Types[name].Latency)
+	}
+	header(bw, "typemux_subscription_delivered_total", "counter", "Number of events delivered, by subscription.")
+	for _, sub := range s.Subscriptions {
+		fmt.Fprintf(bw, "typemux_subscription_delivered_total{%s} %d\n", subLabel(sub), sub.Delivered)
+	}
+	header(bw, "typemux_subscription_dropped_total", "counter", "Number of events dropped, by subscription.")
+	for _, sub := range s.Subscriptions {
+		fmt.Fprintf(bw, "typemux_subscription_dropped_total{%s} %d\n", subLabel(sub), sub.Dropped)
+	}
+	header(bw, "typemux_subscription_blocked_seconds", "histogram", "Time Post spent handing events to a subscription.")
+	for _, sub := range s.Subscriptions {
+		writeHistogram(bw, "typemux_subscription_blocked_seconds", subLabel(sub), sub.Blocked)
+	}
+	return bw.Flush()
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeHistogram(w io.Writer, name, labels string, h HistogramSnapshot) {
+	for _, b := range h.Buckets {
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %d\n", name, labels, b.UpperBound.Seconds(), b.Count)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.Count)
+	fmt.Fprintf(w, "%s_sum{%s} %g\n", name, labels, h.Sum.Seconds())
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.Count)
+}
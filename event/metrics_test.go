@@ -0,0 +1,147 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+)
+
+func TestMetrics(t *testing.T) {
+	mux := NewTypeMux(TypeMuxConfig{Metrics: true})
+	defer mux.Stop()
+
+	var (
+		sub   = mux.SubscribeWithOptions(SubscribeOptions{QueueSize: 1, Overflow: OverflowDropNewest}, DoneEvent{})
+		iface = mux.SubscribeWithOptions(SubscribeOptions{QueueSize: 4}, DoneEvent{}, ChainHeadEvent{})
+		tap   = mux.Tap(4)
+	)
+	mux.Post(DoneEvent{})
+	mux.Post(DoneEvent{})
+	mux.Post(ChainHeadEvent{Number: 1})
+	mux.Post(NewMinedBlockEvent{})
+
+	// A stale event is counted but not delivered.
+	sub.deliver(&TypeMuxEvent{Seq: 0, Data: DoneEvent{}}, nil)
+
+	// DoneEvent reached the first subscription once, the second one and the
+	// tap twice.
+	snap := mux.Metrics()
+	done := snap.Types["event.DoneEvent"]
+	if done.Posts != 2 || done.Subscribers != 2 || done.Stale != 1 || done.Latency.Count != 5 {
+		t.Errorf("Got DoneEvent metrics %+v", done)
+	}
+	if mined := snap.Types["event.NewMinedBlockEvent"]; mined.Posts != 1 || mined.Subscribers != 0 {
+		t.Errorf("Got NewMinedBlockEvent metrics %+v", mined)
+	}
+	if len(snap.Subscriptions) != 3 {
+		t.Fatalf("Got %d subscriptions, expected 3", len(snap.Subscriptions))
+	}
+	want := []SubscriptionMetrics{
+		{ID: sub.id, Types: []string{"event.DoneEvent"}, Delivered: 1, Dropped: 1},
+		{ID: iface.id, Types: []string{"event.ChainHeadEvent", "event.DoneEvent"}, Delivered: 3},
+		{ID: tap.id, Types: []string{"*"}, Delivered: 4},
+	}
+	for i, w := range want {
+		got := snap.Subscriptions[i]
+		if got.ID != w.ID || strings.Join(got.Types, ",") != strings.Join(w.Types, ",") || got.Delivered != w.Delivered || got.Dropped != w.Dropped {
+			t.Errorf("subscription %d: got %+v, expected %+v", i, got, w)
+		}
+		if got.Blocked.Count != got.Delivered {
+			t.Errorf("subscription %d: got %d blocked observations, expected %d", i, got.Blocked.Count, got.Delivered)
+		}
+	}
+
+	// The expvar representation is JSON.
+	var decoded MetricsSnapshot
+	if err := json.Unmarshal([]byte(snap.String()), &decoded); err != nil {
+		t.Fatalf("String is not valid JSON: %v", err)
+	}
+	if decoded.Types["event.DoneEvent"].Posts != 2 {
+		t.Errorf("Got decoded metrics %+v", decoded.Types["event.DoneEvent"])
+	}
+}
+
+func TestMetricsClock(t *testing.T) {
+	clock := new(mclock.Simulated)
+	mux := NewTypeMux(TypeMuxConfig{Metrics: true, Clock: clock})
+	defer mux.Stop()
+
+	sub := mux.SubscribeWithOptions(SubscribeOptions{DeliveryTimeout: time.Second}, DoneEvent{})
+	posted := make(chan error)
+	go func() { posted <- mux.Post(DoneEvent{}) }()
+
+	// Latency and blocking time are measured with the mux clock.
+	clock.WaitForTimers(1)
+	clock.Run(500 * time.Millisecond)
+	<-sub.Chan()
+	if err := <-posted; err != nil {
+		t.Fatalf("Post return unexpected error: %v", err)
+	}
+	snap := mux.Metrics()
+	if latency := snap.Types["event.DoneEvent"].Latency; latency.Count != 1 || latency.Sum != 500*time.Millisecond {
+		t.Errorf("Got latency %+v, expected one observation of 500ms", latency)
+	}
+	if blocked := snap.Subscriptions[0].Blocked; blocked.Count != 1 || blocked.Sum != 500*time.Millisecond {
+		t.Errorf("Got blocked time %+v, expected one observation of 500ms", blocked)
+	}
+}
+
+func TestMetricsPrometheus(t *testing.T) {
+	mux := NewTypeMux(TypeMuxConfig{Metrics: true})
+	defer mux.Stop()
+
+	mux.SubscribeWithOptions(SubscribeOptions{QueueSize: 1}, DoneEvent{})
+	mux.Post(DoneEvent{})
+
+	var buf bytes.Buffer
+	if err := mux.Metrics().WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE typemux_posts_total counter\n",
+		`typemux_posts_total{type="event.DoneEvent"} 1` + "\n",
+		`typemux_subscribers{type="event.DoneEvent"} 1` + "\n",
+		`typemux_delivery_latency_seconds_bucket{type="event.DoneEvent",le="+Inf"} 1` + "\n",
+		`typemux_delivery_latency_seconds_count{type="event.DoneEvent"} 1` + "\n",
+		`typemux_subscription_delivered_total{sub="1"} 1` + "\n",
+		`typemux_subscription_blocked_seconds_bucket{sub="1",le="10"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	h.observe(500 * time.Nanosecond)
+	h.observe(time.Millisecond)
+	h.observe(time.Minute)
+
+	snap := h.snapshot()
+	if snap.Count != 3 || snap.Sum != time.Minute+time.Millisecond+500*time.Nanosecond {
+		t.Errorf("Got count %d, sum %v", snap.Count, snap.Sum)
+	}
+	// Buckets are cumulative, the minute only shows up in +Inf.
+	wantCounts := []uint64{1, 1, 1, 2, 2, 2, 2, 2}
+	for i, b := range snap.Buckets {
+		if b.Count != wantCounts[i] {
+			t.Errorf("bucket le=%v: got %d, expected %d", b.UpperBound, b.Count, wantCounts[i])
+		}
+	}
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	mux.Subscribe(DoneEvent{})
+	if snap := mux.Metrics(); len(snap.Types) != 0 || len(snap.Subscriptions) != 0 {
+		t.Errorf("Got metrics %v from mux without metrics", snap)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package event
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// tapLoggerQueue is the number of events a TapLogger buffers.
+const tapLoggerQueue = 1024
+
+// Tap creates a subscription that receives every event posted to the mux,
+// whatever its type. Taps are meant for tracing and auditing and never slow
+// down Post: the subscription buffers up to queueSize events and drops new
+// events while its buffer is full. Dropped reports how many were lost.
+func (mux *TypeMux) Tap(queueSize int) *TypeMuxSubscription {
+	if queueSize < 1 {
+		panic(fmt.Sprintf("event: invalid queue size %d in Tap", queueSize))
+	}
+	sub := newsub(mux, SubscribeOptions{QueueSize: queueSize, Overflow: OverflowDropNewest})
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	mux.register(sub, nil)
+	if !mux.stopped {
+		mux.taps = append(mux.taps[:len(mux.taps):len(mux.taps)], sub)
+	}
+	return sub
+}
+
+// TapLogger writes every event posted to a mux to a structured logger.
+type TapLogger struct {
+	sub  *TypeMuxSubscription
+	done chan struct{}
+}
+
+// NewTapLogger starts logging the events posted to mux at the given level.
+func NewTapLogger(mux *TypeMux, logger *slog.Logger, level slog.Level) *TapLogger {
+	l := &TapLogger{sub: mux.Tap(tapLoggerQueue), done: make(chan struct{})}
+	go l.loop(logger, level)
+	return l
+}
+
+func (l *TapLogger) loop(logger *slog.Logger, level slog.Level) {
+	defer close(l.done)
+	for ev := range l.sub.Chan() {
+		logger.Log(context.Background(), level, "Posted event",
+			"type", fmt.Sprintf("%T", ev.Data), "seq", ev.Seq, "time", ev.Time, "data", ev.Data)
+	}
+	if dropped := l.sub.Dropped(); dropped > 0 {
+		logger.Warn("Event tap dropped events", "count", dropped)
+	}
+}
+
+// Stop ends logging and waits for the queued events to be written.
+func (l *TapLogger) Stop() {
+	l.sub.Unsubscribe()
+	<-l.done
+}
+
+// Recorder keeps the events posted to a mux in memory, so tests can assert on
+// the exact sequence of events. Since taps are filled before Post returns, all
+// events posted before a call to Events are included in its result.
+type Recorder struct {
+	sub    *TypeMuxSubscription
+	mu     sync.Mutex
+	events []*TypeMuxEvent
+}
+
+// NewRecorder starts recording the events posted to mux. Up to queueSize events
+// are retained between calls to Events; further events are dropped.
+func NewRecorder(mux *TypeMux, queueSize int) *Recorder {
+	return &Recorder{sub: mux.Tap(queueSize)}
+}
+
+// Events returns all events recorded so far in posting order.
+func (r *Recorder) Events() []*TypeMuxEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for {
+		select {
+		case ev, ok := <-r.sub.Chan():
+			if ok {
+				r.events = append(r.events, ev)
+				continue
+			}
+		default:
+		}
+		return append([]*TypeMuxEvent(nil), r.events...)
+	}
+}
+
+// Data returns the payloads of all events recorded so far in posting order.
+func (r *Recorder) Data() []interface{} {
+	events := r.Events()
+	data := make([]interface{}, len(events))
+	for i, ev := range events {
+		data[i] = ev.Data
+	}
+	return data
+}
+
+// Dropped returns the number of events that were not recorded because the
+// queue was full.
+func (r *Recorder) Dropped() uint64 {
+	return r.sub.Dropped()
+}
+
+// Stop ends recording. Events recorded before Stop remain available.
+func (r *Recorder) Stop() {
+	r.Events()
+	r.sub.Unsubscribe()
+}
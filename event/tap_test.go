@@ -0,0 +1,104 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTap(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	var (
+		tap   = mux.Tap(2)
+		typed = mux.Subscribe(DoneEvent{})
+	)
+	go func() { <-typed.Chan() }()
+
+	// The tap sees every type and never blocks Post.
+	mux.Post(ChainHeadEvent{Number: 1})
+	mux.Post(DoneEvent{})
+	mux.Post(NewMinedBlockEvent{})
+
+	if ev := <-tap.Chan(); ev.Data != (ChainHeadEvent{Number: 1}) {
+		t.Errorf("Got %v, expected %v", ev.Data, ChainHeadEvent{Number: 1})
+	}
+	if ev := <-tap.Chan(); ev.Data != (DoneEvent{}) {
+		t.Errorf("Got %v, expected %v", ev.Data, DoneEvent{})
+	}
+	if n := tap.Dropped(); n != 1 {
+		t.Errorf("Got %d dropped events, expected 1", n)
+	}
+	tap.Unsubscribe()
+	if len(mux.taps) != 0 {
+		t.Errorf("tap was not removed")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	rec := NewRecorder(&mux, 16)
+	posted := []interface{}{ChainHeadEvent{Number: 1}, DoneEvent{}, &ChainHeadEvent{Number: 2}}
+	for _, ev := range posted {
+		mux.Post(ev)
+	}
+	if got := rec.Data(); !reflect.DeepEqual(got, posted) {
+		t.Errorf("Got %v, expected %v", got, posted)
+	}
+	rec.Stop()
+	mux.Post(DoneEvent{})
+	if got := rec.Events(); len(got) != len(posted) {
+		t.Errorf("Got %d events after stop, expected %d", len(got), len(posted))
+	}
+	for i, ev := range rec.Events() {
+		if ev.Seq != uint64(i+1) {
+			t.Errorf("event %d: got sequence %d, expected %d", i, ev.Seq, i+1)
+		}
+	}
+}
+
+func TestRecorderStopGraceful(t *testing.T) {
+	var mux TypeMux
+	rec := NewRecorder(&mux, 16)
+	mux.Post(DoneEvent{})
+
+	// The recorder's queue is only read by Events, StopGraceful must not wait for it.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := mux.StopGraceful(ctx); err != nil {
+		t.Errorf("StopGraceful return unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("StopGraceful took %v", elapsed)
+	}
+	if got := rec.Data(); len(got) != 1 {
+		t.Errorf("Got %v, expected the posted event", got)
+	}
+}
+
+func TestTapLogger(t *testing.T) {
+	var (
+		mux TypeMux
+		buf bytes.Buffer
+	)
+	defer mux.Stop()
+
+	logger := NewTapLogger(&mux, slog.New(slog.NewTextHandler(&buf, nil)), slog.LevelInfo)
+	mux.Post(ChainHeadEvent{Number: 7})
+	logger.Stop()
+
+	out := buf.String()
+	for _, want := range []string{"Posted event", "type=event.ChainHeadEvent", "seq=1", `data="head #7"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output %q does not contain %q", out, want)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package event
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Topic wildcards. A topic is a dot-separated list of words such as
+// "txpool.add.local". In subscription patterns, "*" matches exactly one word
+// and "#" matches zero or more words, so "txpool.*" matches "txpool.add" and
+// "chain.#" matches "chain", "chain.head" and "chain.side.block".
+const (
+	topicSeparator = "."
+	wildcardOne    = "*"
+	wildcardMany   = "#"
+)
+
+// TopicEvent is a time-tagged notification pushed to topic subscribers.
+type TopicEvent struct {
+	Time  time.Time
+	Seq   uint64 // position in the posting order of the mux, starting at 1
+	Topic string
+	Data  interface{}
+}
+
+// A TopicMux dispatches events to registered receivers by topic. Receivers
+// subscribe with topic patterns which may contain wildcards. Any operation
+// called after mux is stopped will return ErrMuxClosed.
+//
+// Patterns are kept in a trie keyed by topic words, so the cost of routing an
+// event depends on the depth of its topic rather than on the number of
+// subscriptions.
+//
+// The zero value is ready to use.
+type TopicMux struct {
+	mutex    sync.RWMutex
+	root     topicNode
+	stopped  bool
+	inflight sync.WaitGroup // Post calls in progress
+	seq      atomic.Uint64  // sequence number of the last posted event
+}
+
+// topicNode is a node of the subscription trie. Wildcard words are stored as
+// regular children.
+type topicNode struct {
+	children map[string]*topicNode
+	subs     []*TopicSubscription // subscriptions whose pattern ends here
+}
+
+// Subscribe creates a subscription for events whose topic matches one of the
+// given patterns. The subscription's channel is closed when it is unsubscribed
+// or the mux is closed.
+func (mux *TopicMux) Subscribe(patterns ...string) *TopicSubscription {
+	for i, pattern := range patterns {
+		if !validTopic(pattern, true) {
+			panic(fmt.Sprintf("event: invalid topic pattern %q in Subscribe", pattern))
+		}
+		for _, prev := range patterns[:i] {
+			if prev == pattern {
+				panic(fmt.Sprintf("event: duplicate topic %s in Subscribe", pattern))
+			}
+		}
+	}
+	sub := newTopicSub(mux, patterns)
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	if mux.stopped {
+		// set the status to closed so that calling Unsubscribe after this
+		// call will short circuit.
+		sub.closed = true
+		close(sub.closing)
+		close(sub.postC)
+		return sub
+	}
+	for _, pattern := range patterns {
+		node := &mux.root
+		for _, word := range strings.Split(pattern, topicSeparator) {
+			if node.children == nil {
+				node.children = make(map[string]*topicNode)
+			}
+			child := node.children[word]
+			if child == nil {
+				child = new(topicNode)
+				node.children[word] = child
+			}
+			node = child
+		}
+		node.subs = append(node.subs, sub)
+	}
+	return sub
+}
+
+// Post sends an event to all receivers whose pattern matches topic. Topics must
+// not contain wildcards. It returns ErrMuxClosed if the mux has been stopped.
+func (mux *TopicMux) Post(topic string, ev interface{}) error {
+	if !validTopic(topic, false) {
+		return fmt.Errorf("event: invalid topic %q in Post", topic)
+	}
+	event := &TopicEvent{
+		Time:  time.Now(),
+		Seq:   mux.seq.Add(1),
+		Topic: topic,
+		Data:  ev,
+	}
+	mux.mutex.RLock()
+	if mux.stopped {
+		mux.mutex.RUnlock()
+		return ErrMuxClosed
+	}
+	subs := mux.root.match(strings.Split(topic, topicSeparator), nil)
+	mux.inflight.Add(1)
+	mux.mutex.RUnlock()
+	defer mux.inflight.Done()
+
+	for _, sub := range subs {
+		sub.deliver(event)
+	}
+	return nil
+}
+
+// Stop closes a mux. The mux can no longer be used.
+// Future Post calls will fail with ErrMuxClosed.
+// Stop blocks until all current deliveries have finished.
+func (mux *TopicMux) Stop() {
+	mux.mutex.Lock()
+	mux.root.walk(func(sub *TopicSubscription) { sub.closewait() })
+	mux.root = topicNode{}
+	mux.stopped = true
+	mux.mutex.Unlock()
+
+	mux.inflight.Wait()
+}
+
+func (mux *TopicMux) del(s *TopicSubscription) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	for _, pattern := range s.patterns {
+		mux.root.remove(strings.Split(pattern, topicSeparator), s)
+	}
+}
+
+// validTopic reports whether topic is a non-empty list of non-empty words.
+// Wildcard words are only allowed in patterns.
+func validTopic(topic string, pattern bool) bool {
+	for _, word := range strings.Split(topic, topicSeparator) {
+		if word == "" {
+			return false
+		}
+		if strings.ContainsAny(word, wildcardOne+wildcardMany) && (!pattern || len(word) > 1) {
+			return false
+		}
+	}
+	return true
+}
+
+// match appends the subscriptions matching the topic words to subs. Each
+// subscription is included once, even if several of its patterns match.
+func (n *topicNode) match(words []string, subs []*TopicSubscription) []*TopicSubscription {
+	if many := n.children[wildcardMany]; many != nil {
+		// "#" consumes any number of the remaining words.
+		for i := 0; i <= len(words); i++ {
+			subs = many.match(words[i:], subs)
+		}
+	}
+	if len(words) == 0 {
+		for _, sub := range n.subs {
+			if !containsTopicSub(subs, sub) {
+				subs = append(subs, sub)
+			}
+		}
+		return subs
+	}
+	if child := n.children[words[0]]; child != nil {
+		subs = child.match(words[1:], subs)
+	}
+	if one := n.children[wildcardOne]; one != nil {
+		subs = one.match(words[1:], subs)
+	}
+	return subs
+}
+
+// remove deletes sub from the node at the end of the given pattern words and
+// prunes nodes that are no longer needed. It reports whether n became empty.
+func (n *topicNode) remove(words []string, sub *TopicSubscription) bool {
+	if len(words) == 0 {
+		for i, s := range n.subs {
+			if s == sub {
+				n.subs = append(n.subs[:i:i], n.subs[i+1:]...)
+				break
+			}
+		}
+	} else if child := n.children[words[0]]; child != nil {
+		if child.remove(words[1:], sub) {
+			delete(n.children, words[0])
+		}
+	}
+	return len(n.subs) == 0 && len(n.children) == 0
+}
+
+// walk calls fn for every subscription in the trie below n.
+func (n *topicNode) walk(fn func(*TopicSubscription)) {
+	for _, sub := range n.subs {
+		fn(sub)
+	}
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+}
+
+func containsTopicSub(subs []*TopicSubscription, sub *TopicSubscription) bool {
+	for _, s := range subs {
+		if s == sub {
+			return true
+		}
+	}
+	return false
+}
+
+// TopicSubscription is a subscription established through TopicMux.
+type TopicSubscription struct {
+	mux      *TopicMux
+	patterns []string
+	created  uint64 // sequence number of the last event posted before creation
+	closeMu  sync.Mutex
+	closing  chan struct{}
+	closed   bool
+
+	// these two are the same channel. they are stored separately so
+	// postC can be set to nil without affecting the return value of
+	// Chan.
+	postMu sync.RWMutex
+	readC  <-chan *TopicEvent
+	postC  chan<- *TopicEvent
+}
+
+func newTopicSub(mux *TopicMux, patterns []string) *TopicSubscription {
+	c := make(chan *TopicEvent)
+	return &TopicSubscription{
+		mux:      mux,
+		patterns: patterns,
+		created:  mux.seq.Load(),
+		readC:    c,
+		postC:    c,
+		closing:  make(chan struct{}),
+	}
+}
+
+func (s *TopicSubscription) Chan() <-chan *TopicEvent {
+	return s.readC
+}
+
+func (s *TopicSubscription) Unsubscribe() {
+	s.mux.del(s)
+	s.closewait()
+}
+
+func (s *TopicSubscription) closewait() {
+	s.closeMu.Lock()
+	defer s.closeMu.Unlock()
+	if s.closed {
+		return
+	}
+	close(s.closing)
+	s.closed = true
+
+	s.postMu.Lock()
+	close(s.postC)
+	s.postC = nil
+	s.postMu.Unlock()
+}
+
+func (s *TopicSubscription) deliver(event *TopicEvent) {
+	// Short circuit delivery if stale event
+	if event.Seq <= s.created {
+		return
+	}
+	// Otherwise deliver the event
+	s.postMu.RLock()
+	defer s.postMu.RUnlock()
+
+	select {
+	case s.postC <- event:
+	case <-s.closing:
+	}
+}
@@ -0,0 +1,131 @@
+package event
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTopicMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		match   []string
+		nomatch []string
+	}{
+		{"chain.head", []string{"chain.head"}, []string{"chain", "chain.head.x", "chain.side"}},
+		{"txpool.*", []string{"txpool.add", "txpool.drop"}, []string{"txpool", "txpool.add.local"}},
+		{"txpool.*.local", []string{"txpool.add.local"}, []string{"txpool.add.remote", "txpool.add"}},
+		{"chain.#", []string{"chain", "chain.head", "chain.side.block"}, []string{"txpool.add", "chainx"}},
+		{"#.local", []string{"local", "txpool.add.local"}, []string{"txpool.add.remote"}},
+		{"#", []string{"chain", "txpool.add.local"}, nil},
+		{"*.#.local", []string{"txpool.local", "txpool.add.local"}, []string{"local"}},
+	}
+	for _, test := range tests {
+		var mux TopicMux
+		mux.Subscribe(test.pattern)
+		for _, topic := range test.match {
+			if subs := mux.root.match(strings.Split(topic, topicSeparator), nil); len(subs) != 1 {
+				t.Errorf("pattern %q: topic %q matched %d subscriptions, expected 1", test.pattern, topic, len(subs))
+			}
+		}
+		for _, topic := range test.nomatch {
+			if subs := mux.root.match(strings.Split(topic, topicSeparator), nil); len(subs) != 0 {
+				t.Errorf("pattern %q: topic %q matched %d subscriptions, expected 0", test.pattern, topic, len(subs))
+			}
+		}
+		mux.Stop()
+	}
+}
+
+func TestTopicSubscribe(t *testing.T) {
+	var mux TopicMux
+	defer mux.Stop()
+
+	// Both patterns match, the event is delivered once.
+	sub := mux.Subscribe("txpool.*", "txpool.#")
+	go func() {
+		if err := mux.Post("txpool.add", DoneEvent{}); err != nil {
+			t.Errorf("Post return unexpected error: %v", err)
+		}
+		sub.Unsubscribe()
+	}()
+
+	var got []*TopicEvent
+	for ev := range sub.Chan() {
+		got = append(got, ev)
+	}
+	if len(got) != 1 || got[0].Topic != "txpool.add" || got[0].Data != (DoneEvent{}) {
+		t.Errorf("Got %v, expected one txpool.add event", got)
+	}
+}
+
+func TestTopicUnsubscribePrunes(t *testing.T) {
+	var mux TopicMux
+	defer mux.Stop()
+
+	keep := mux.Subscribe("chain.head")
+	defer keep.Unsubscribe()
+	sub := mux.Subscribe("chain.side.#", "txpool.*")
+	sub.Unsubscribe()
+
+	if _, ok := mux.root.children["txpool"]; ok {
+		t.Errorf("txpool node was not pruned")
+	}
+	if _, ok := mux.root.children["chain"].children["side"]; ok {
+		t.Errorf("chain.side node was not pruned")
+	}
+	if _, ok := mux.root.children["chain"].children["head"]; !ok {
+		t.Errorf("chain.head node was pruned")
+	}
+}
+
+func TestTopicInvalid(t *testing.T) {
+	var mux TopicMux
+	defer mux.Stop()
+
+	for _, topic := range []string{"", "chain.", "chain.*", "chain.#", "a..b"} {
+		if err := mux.Post(topic, DoneEvent{}); err == nil {
+			t.Errorf("Post accepted invalid topic %q", topic)
+		}
+	}
+	for _, pattern := range []string{"", "chain.", "chain.h*", "a..b"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Subscribe accepted invalid pattern %q", pattern)
+				}
+			}()
+			mux.Subscribe(pattern)
+		}()
+	}
+}
+
+func TestTopicPostAfterStop(t *testing.T) {
+	var mux TopicMux
+	mux.Stop()
+
+	sub := mux.Subscribe("chain.head")
+	if _, isOpen := <-sub.Chan(); isOpen {
+		t.Errorf("Subscription channel was not closed")
+	}
+	sub.Unsubscribe()
+	if err := mux.Post("chain.head", DoneEvent{}); err != ErrMuxClosed {
+		t.Errorf("Got: %s, expected error: %s", err, ErrMuxClosed)
+	}
+}
+
+func BenchmarkTopicMatch10000(b *testing.B) {
+	var mux TopicMux
+	defer mux.Stop()
+	for i := 0; i < 10000; i++ {
+		mux.Subscribe(fmt.Sprintf("peer.%d.*", i), fmt.Sprintf("peer.%d.msg.#", i))
+	}
+	words := strings.Split("peer.5000.msg.tx", topicSeparator)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if subs := mux.root.match(words, nil); len(subs) != 1 {
+			panic("wrong number of matches")
+		}
+	}
+}
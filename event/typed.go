@@ -0,0 +1,102 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package event
+
+import (
+	"reflect"
+)
+
+// TypedMux is a type-safe view of a TypeMux for events of type T.
+//
+// Events posted through a TypedMux are routed by the underlying TypeMux, so
+// subscribers created with TypeMux.Subscribe(T{}) receive them as well, and
+// events posted with TypeMux.Post are delivered to typed subscribers. This allows
+// migrating one producer or consumer at a time.
+//
+// If T is an interface type, subscriptions receive every event whose type
+// implements T, as with TypeMux.SubscribeInterface.
+type TypedMux[T any] struct {
+	mux *TypeMux
+}
+
+// NewTypedMux creates a typed view of mux for events of type T.
+func NewTypedMux[T any](mux *TypeMux) *TypedMux[T] {
+	return &TypedMux[T]{mux: mux}
+}
+
+// Subscribe creates a subscription for events of type T.
+func (m *TypedMux[T]) Subscribe() *TypedSubscription[T] {
+	return Subscribe[T](m.mux)
+}
+
+// Post sends ev to all receivers registered for type T.
+// It returns ErrMuxClosed if the mux has been stopped.
+func (m *TypedMux[T]) Post(ev T) error {
+	return Post(m.mux, ev)
+}
+
+// Subscribe creates a subscription on mux for events of type T. The subscription's
+// channel is closed when it is unsubscribed or the mux is closed.
+func Subscribe[T any](mux *TypeMux) *TypedSubscription[T] {
+	sub := newsub(mux, SubscribeOptions{})
+	sub.forwarded = true
+	mux.subscribe(sub, []reflect.Type{reflect.TypeFor[T]()})
+	return newTypedSub[T](sub)
+}
+
+// Post sends ev to all receivers of mux registered for type T.
+// It returns ErrMuxClosed if the mux has been stopped.
+func Post[T any](mux *TypeMux, ev T) error {
+	return mux.Post(ev)
+}
+
+// TypedSubscription is a subscription established through Subscribe or TypedMux.
+// Unlike TypeMuxSubscription, its channel carries the event values themselves.
+type TypedSubscription[T any] struct {
+	sub *TypeMuxSubscription
+	c   chan T
+}
+
+func newTypedSub[T any](sub *TypeMuxSubscription) *TypedSubscription[T] {
+	s := &TypedSubscription[T]{sub: sub, c: make(chan T)}
+	go s.forward()
+	return s
+}
+
+// forward moves events from the underlying subscription to the typed channel.
+// The typed channel is closed when the underlying subscription ends.
+func (s *TypedSubscription[T]) forward() {
+	defer close(s.c)
+	for ev := range s.sub.Chan() {
+		select {
+		case s.c <- ev.Data.(T):
+			s.sub.unread.Add(-1)
+		case <-s.sub.closing:
+			return
+		}
+	}
+}
+
+// Chan returns the channel on which events are delivered.
+func (s *TypedSubscription[T]) Chan() <-chan T {
+	return s.c
+}
+
+// Unsubscribe removes the subscription from the mux and closes its channel.
+func (s *TypedSubscription[T]) Unsubscribe() {
+	s.sub.Unsubscribe()
+}
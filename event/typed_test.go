@@ -0,0 +1,123 @@
+package event
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type ChainHeadEvent struct{ Number uint64 }
+
+func TestTypedSubscribe(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	heads := NewTypedMux[ChainHeadEvent](&mux)
+	sub := heads.Subscribe()
+
+	go func() {
+		if err := heads.Post(ChainHeadEvent{Number: 1}); err != nil {
+			t.Errorf("Post return unexpected error: %v", err)
+		}
+	}()
+
+	if ev := <-sub.Chan(); ev.Number != 1 {
+		t.Errorf("Got: %v, expect event: %v", ev, ChainHeadEvent{Number: 1})
+	}
+}
+
+func TestTypedInterop(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	var (
+		typed  = Subscribe[ChainHeadEvent](&mux)
+		legacy = mux.Subscribe(ChainHeadEvent{})
+	)
+	defer typed.Unsubscribe()
+	defer legacy.Unsubscribe()
+
+	// Post through the generic API, receive on the legacy subscription.
+	go Post(&mux, ChainHeadEvent{Number: 1})
+	<-typed.Chan()
+	ev := <-legacy.Chan()
+	if head, ok := ev.Data.(ChainHeadEvent); !ok || head.Number != 1 {
+		t.Errorf("Got: %v (%T), expect event: %v", ev.Data, ev.Data, ChainHeadEvent{Number: 1})
+	}
+
+	// Post through the legacy API, receive on the typed subscription.
+	go mux.Post(ChainHeadEvent{Number: 2})
+	<-legacy.Chan()
+	if head := <-typed.Chan(); head.Number != 2 {
+		t.Errorf("Got: %v, expect event: %v", head, ChainHeadEvent{Number: 2})
+	}
+}
+
+func TestTypedUnsubscribe(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	sub := Subscribe[ChainHeadEvent](&mux)
+	sub.Unsubscribe()
+
+	if _, isOpen := <-sub.Chan(); isOpen {
+		t.Errorf("Subscription channel was not closed")
+	}
+	if err := Post(&mux, ChainHeadEvent{}); err != nil {
+		t.Errorf("Post return unexpected error: %v", err)
+	}
+}
+
+func TestTypedSubscribeAfterStop(t *testing.T) {
+	var mux TypeMux
+	mux.Stop()
+
+	sub := Subscribe[ChainHeadEvent](&mux)
+	if _, isOpen := <-sub.Chan(); isOpen {
+		t.Errorf("Subscription channel was not closed")
+	}
+	sub.Unsubscribe()
+
+	if err := Post(&mux, ChainHeadEvent{}); err != ErrMuxClosed {
+		t.Errorf("Got: %s, expected error: %s", err, ErrMuxClosed)
+	}
+}
+
+func TestTypedSubscribeInterface(t *testing.T) {
+	var mux TypeMux
+	defer mux.Stop()
+
+	sub := Subscribe[ChainEvent](&mux)
+	defer sub.Unsubscribe()
+
+	go mux.Post(ChainHeadEvent{Number: 3})
+	if ev := <-sub.Chan(); ev.BlockNumber() != 3 {
+		t.Errorf("Got: %v, expect event: %v", ev, ChainHeadEvent{Number: 3})
+	}
+}
+
+func TestTypedStopGraceful(t *testing.T) {
+	var mux TypeMux
+	sub := Subscribe[ChainHeadEvent](&mux)
+
+	// Post returns once the forwarder has taken the event off the queue.
+	if err := Post(&mux, ChainHeadEvent{Number: 1}); err != nil {
+		t.Fatalf("Post return unexpected error: %v", err)
+	}
+	stopped := make(chan error)
+	go func() { stopped <- mux.StopGraceful(context.Background()) }()
+	select {
+	case <-stopped:
+		t.Fatal("StopGraceful returned before the forwarded event was read")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if ev, isOpen := <-sub.Chan(); !isOpen || ev.Number != 1 {
+		t.Errorf("Got: %v, expect event: %v", ev, ChainHeadEvent{Number: 1})
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("StopGraceful return unexpected error: %v", err)
+	}
+	if _, isOpen := <-sub.Chan(); isOpen {
+		t.Errorf("Subscription channel was not closed")
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMailboxSize is the mailbox capacity of AsyncFeed subscribers unless
+// configured otherwise.
+const DefaultMailboxSize = 256
+
+// AsyncFeed is a feed whose Send does not wait for subscribers. Every subscriber has
+// a bounded mailbox and a goroutine that delivers the values from its mailbox to its
+// channel, in the order they were sent. When a mailbox is full, Send drops the value
+// for that subscriber and counts it in the mailbox statistics.
+//
+// Like Feed, an AsyncFeed can only be used with a single type, determined by the
+// first Send or Subscribe. Subsequent calls to these methods panic if the type does
+// not match.
+//
+// The zero value is ready to use.
+type AsyncFeed struct {
+	mu          sync.Mutex
+	etype       reflect.Type
+	mailboxSize int // zero means DefaultMailboxSize
+	subs        map[*asyncSub]struct{}
+	closed      bool
+}
+
+// SetMailboxSize sets the mailbox capacity of subscriptions created afterwards.
+func (f *AsyncFeed) SetMailboxSize(size int) {
+	if size < 1 {
+		panic(fmt.Sprintf("event: invalid mailbox size %d", size))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mailboxSize = size
+}
+
+// Subscribe adds a channel to the feed. Future sends will be delivered on the channel
+// until the subscription is canceled. All channels added must have the same element
+// type. The subscriber gets a mailbox of the size set by SetMailboxSize.
+//
+// Subscribing to a closed feed returns a subscription that has already ended with
+// ErrFeedClosed.
+func (f *AsyncFeed) Subscribe(channel interface{}) Subscription {
+	return f.subscribe(channel, 0)
+}
+
+// SubscribeWithMailbox adds a channel to the feed like Subscribe, with a mailbox of
+// the given size.
+func (f *AsyncFeed) SubscribeWithMailbox(channel interface{}, size int) Subscription {
+	if size < 1 {
+		panic(fmt.Sprintf("event: invalid mailbox size %d", size))
+	}
+	return f.subscribe(channel, size)
+}
+
+func (f *AsyncFeed) subscribe(channel interface{}, size int) Subscription {
+	chanval := sendableChan(channel)
+	chantyp := chanval.Type()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.etype == nil {
+		f.etype = chantyp.Elem()
+	}
+	if f.etype != chantyp.Elem() {
+		panic(feedTypeError{op: "Subscribe", got: chantyp, want: reflect.ChanOf(reflect.SendDir, f.etype)})
+	}
+	if size == 0 {
+		size = f.mailboxSize
+	}
+	if size == 0 {
+		size = DefaultMailboxSize
+	}
+	sub := &asyncSub{
+		feed:    f,
+		channel: chanval,
+		mailbox: make(chan reflect.Value, size),
+		closing: make(chan struct{}),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+		err:     make(chan error, 1),
+	}
+	if f.closed {
+		close(sub.done)
+		sub.end(ErrFeedClosed)
+		return sub
+	}
+	if f.subs == nil {
+		f.subs = make(map[*asyncSub]struct{})
+	}
+	f.subs[sub] = struct{}{}
+	go sub.loop()
+	return sub
+}
+
+// Send puts the value into the mailboxes of all subscribers and returns without
+// waiting for its delivery. It returns the number of mailboxes the value was put
+// into, which excludes the full ones.
+func (f *AsyncFeed) Send(value interface{}) (nsent int) {
+	rvalue := reflect.ValueOf(value)
+
+	// Holding the lock keeps the order of values the same in all mailboxes.
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.etype == nil {
+		f.etype = rvalue.Type()
+	}
+	if f.etype != rvalue.Type() {
+		panic(feedTypeError{op: "Send", got: rvalue.Type(), want: f.etype})
+	}
+	if f.closed {
+		return 0
+	}
+	for sub := range f.subs {
+		select {
+		case sub.mailbox <- rvalue:
+			nsent++
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+	return nsent
+}
+
+// Close shuts down the feed. Every subscriber receives the values left in its
+// mailbox, then its subscription ends: ErrFeedClosed is delivered on its Err
+// channel, which is then closed. Later calls to Send return 0 and later
+// subscriptions end right away. Close does not wait for the mailboxes to drain.
+func (f *AsyncFeed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	f.closed = true
+	for sub := range f.subs {
+		close(sub.closing)
+	}
+}
+
+// MailboxStats describes the mailbox of an AsyncFeed subscriber.
+type MailboxStats struct {
+	Channel  interface{} // the subscribed channel
+	Depth    int         // values waiting to be delivered
+	Capacity int         // size of the mailbox
+	Dropped  uint64      // values dropped by Send because the mailbox was full
+}
+
+// Stats returns the state of the mailboxes of all live subscriptions, in no
+// particular order. Each entry names the channel of its subscription.
+func (f *AsyncFeed) Stats() []MailboxStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := make([]MailboxStats, 0, len(f.subs))
+	for sub := range f.subs {
+		stats = append(stats, sub.stats())
+	}
+	return stats
+}
+
+// MailboxOf returns the state of the mailbox of a subscription made on the feed.
+// The boolean is false if sub is not a live subscription of the feed.
+func (f *AsyncFeed) MailboxOf(sub Subscription) (MailboxStats, bool) {
+	asub, ok := sub.(*asyncSub)
+	if !ok {
+		return MailboxStats{}, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subs[asub]; !ok {
+		return MailboxStats{}, false
+	}
+	return asub.stats(), true
+}
+
+func (f *AsyncFeed) remove(sub *asyncSub) {
+	f.mu.Lock()
+	delete(f.subs, sub)
+	f.mu.Unlock()
+}
+
+type asyncSub struct {
+	feed     *AsyncFeed
+	channel  reflect.Value
+	mailbox  chan reflect.Value
+	dropped  atomic.Uint64
+	closing  chan struct{} // closed by AsyncFeed.Close
+	quit     chan struct{} // closed by Unsubscribe
+	quitOnce sync.Once
+	done     chan struct{} // closed when loop has returned
+	errOnce  sync.Once
+	err      chan error
+}
+
+// loop delivers the values in the mailbox until the subscription is canceled, or the
+// feed is closed and the mailbox is empty.
+func (sub *asyncSub) loop() {
+	defer close(sub.done)
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: sub.channel},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub.quit)},
+	}
+	deliver := func(v reflect.Value) bool {
+		if sub.channel.TrySend(v) {
+			return true
+		}
+		cases[0].Send = v
+		chosen, _, _ := reflect.Select(cases)
+		cases[0].Send = reflect.Value{}
+		return chosen == 0
+	}
+	for {
+		select {
+		case v := <-sub.mailbox:
+			if !deliver(v) {
+				return
+			}
+		case <-sub.closing:
+			for {
+				select {
+				case v := <-sub.mailbox:
+					if !deliver(v) {
+						return
+					}
+				default:
+					sub.feed.remove(sub)
+					sub.end(ErrFeedClosed)
+					return
+				}
+			}
+		case <-sub.quit:
+			return
+		}
+	}
+}
+
+func (sub *asyncSub) stats() MailboxStats {
+	return MailboxStats{
+		Channel:  sub.channel.Interface(),
+		Depth:    len(sub.mailbox),
+		Capacity: cap(sub.mailbox),
+		Dropped:  sub.dropped.Load(),
+	}
+}
+
+func (sub *asyncSub) Unsubscribe() {
+	// Wait for loop outside of errOnce, loop may be ending the subscription.
+	sub.quitOnce.Do(func() { close(sub.quit) })
+	<-sub.done
+	sub.feed.remove(sub)
+	sub.errOnce.Do(func() { close(sub.err) })
+}
+
+func (sub *asyncSub) Err() <-chan error {
+	return sub.err
+}
+
+// end ends the subscription on behalf of the feed, delivering err.
+func (sub *asyncSub) end(err error) {
+	sub.errOnce.Do(func() {
+		sub.err <- err
+		close(sub.err)
+	})
+}
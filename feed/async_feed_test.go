@@ -0,0 +1,166 @@
+package feed
+
+import (
+	"testing"
+	"time"
+)
+
+// waitMailbox waits until the single mailbox of the feed has the given depth.
+func waitMailbox(t *testing.T, feed *AsyncFeed, depth int) MailboxStats {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		stats := feed.Stats()
+		if len(stats) == 1 && stats[0].Depth == depth {
+			return stats[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Got: %v, expected one mailbox of depth %d", stats, depth)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAsyncFeed(t *testing.T) {
+	var feed AsyncFeed
+	ch := make(chan int)
+	sub := feed.Subscribe(ch)
+	defer sub.Unsubscribe()
+
+	// Nobody reads ch, Send must not wait.
+	for i := 0; i < 10; i++ {
+		if nsent := feed.Send(i); nsent != 1 {
+			t.Errorf("send delivered %d times, want 1", nsent)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if v := receive(t, ch); v != i {
+			t.Errorf("received %d, want %d", v, i)
+		}
+	}
+}
+
+func TestAsyncFeedMailboxFull(t *testing.T) {
+	var feed AsyncFeed
+	feed.SetMailboxSize(2)
+	ch := make(chan int)
+	sub := feed.Subscribe(ch)
+	defer sub.Unsubscribe()
+
+	// The first value is taken out of the mailbox and waits for the channel.
+	feed.Send(0)
+	waitMailbox(t, &feed, 0)
+	for i := 1; i <= 2; i++ {
+		if nsent := feed.Send(i); nsent != 1 {
+			t.Errorf("send delivered %d times, want 1", nsent)
+		}
+	}
+	if nsent := feed.Send(3); nsent != 0 {
+		t.Errorf("send to full mailbox delivered %d times, want 0", nsent)
+	}
+	stats := waitMailbox(t, &feed, 2)
+	if stats.Capacity != 2 || stats.Dropped != 1 {
+		t.Errorf("Got: %+v, expected capacity 2 and 1 dropped", stats)
+	}
+	for i := 0; i <= 2; i++ {
+		if v := receive(t, ch); v != i {
+			t.Errorf("received %d, want %d", v, i)
+		}
+	}
+	waitMailbox(t, &feed, 0)
+
+	// The statistics tell the subscriptions apart.
+	otherCh := make(chan int, 1)
+	other := feed.SubscribeWithMailbox(otherCh, 5)
+	defer other.Unsubscribe()
+	capacity := make(map[interface{}]int)
+	for _, stats := range feed.Stats() {
+		capacity[stats.Channel] = stats.Capacity
+	}
+	if len(capacity) != 2 || capacity[ch] != 2 || capacity[otherCh] != 5 {
+		t.Errorf("Got capacities %v, expected 2 for %v and 5 for %v", capacity, ch, otherCh)
+	}
+	if stats, ok := feed.MailboxOf(sub); !ok || stats.Channel != ch || stats.Dropped != 1 {
+		t.Errorf("Got: %+v, %t, expected the mailbox of the first subscription", stats, ok)
+	}
+	other.Unsubscribe()
+	if _, ok := feed.MailboxOf(other); ok {
+		t.Errorf("MailboxOf returned stats for ended subscription")
+	}
+}
+
+func TestAsyncFeedUnsubscribe(t *testing.T) {
+	var feed AsyncFeed
+	ch := make(chan int)
+	sub := feed.Subscribe(ch)
+
+	feed.Send(1)
+	feed.Send(2)
+	sub.Unsubscribe()
+	if _, ok := <-sub.Err(); ok {
+		t.Errorf("error channel not closed")
+	}
+	if nsent := feed.Send(3); nsent != 0 {
+		t.Errorf("send delivered %d times after Unsubscribe, want 0", nsent)
+	}
+	if stats := feed.Stats(); len(stats) != 0 {
+		t.Errorf("Got: %+v, expected no mailboxes", stats)
+	}
+	select {
+	case v := <-ch:
+		t.Errorf("received %d after Unsubscribe", v)
+	default:
+	}
+}
+
+func TestAsyncFeedClose(t *testing.T) {
+	var feed AsyncFeed
+	ch := make(chan int)
+	sub := feed.Subscribe(ch)
+	defer sub.Unsubscribe()
+
+	feed.Send(1)
+	feed.Send(2)
+	feed.Close()
+	if nsent := feed.Send(3); nsent != 0 {
+		t.Errorf("send delivered %d times after Close, want 0", nsent)
+	}
+
+	// The values sent before Close are delivered before the error.
+	for i := 1; i <= 2; i++ {
+		if v := receive(t, ch); v != i {
+			t.Errorf("received %d, want %d", v, i)
+		}
+	}
+	if err := receive(t, sub.Err()); err != ErrFeedClosed {
+		t.Errorf("Got: %v, expected error: %v", err, ErrFeedClosed)
+	}
+	late := feed.Subscribe(make(chan int))
+	if err := receive(t, late.Err()); err != ErrFeedClosed {
+		t.Errorf("Got: %v, expected error: %v", err, ErrFeedClosed)
+	}
+	late.Unsubscribe()
+}
+
+func TestAsyncFeedTypeCheck(t *testing.T) {
+	var feed AsyncFeed
+	sub := feed.Subscribe(make(chan int))
+	defer sub.Unsubscribe()
+
+	for _, fn := range []func(){
+		func() { feed.Send("x") },
+		func() { feed.Subscribe(make(chan string)) },
+	} {
+		func() {
+			defer func() {
+				if _, ok := recover().(feedTypeError); !ok {
+					t.Errorf("mismatched type did not panic")
+				}
+			}()
+			fn()
+		}()
+	}
+	if nsent := feed.Send(1); nsent != 1 {
+		t.Errorf("send delivered %d times, want 1", nsent)
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// typedFeed is the API shared by Feed and VicFeed.
+type typedFeed interface {
+	Subscribe(channel interface{}) Subscription
+	Send(value interface{}) int
+	Close()
+}
+
+// feedImpls lists the feed implementations that must behave the same way.
+var feedImpls = []struct {
+	name string
+	new  func() typedFeed
+}{
+	{"Feed", func() typedFeed { return new(Feed) }},
+	{"VicFeed", func() typedFeed { return new(VicFeed) }},
+}
+
+// runConformance runs a test against every feed implementation.
+func runConformance(t *testing.T, test func(t *testing.T, newFeed func() typedFeed)) {
+	for _, impl := range feedImpls {
+		t.Run(impl.name, func(t *testing.T) { test(t, impl.new) })
+	}
+}
+
+func TestConformanceTypeChecks(t *testing.T) {
+	runConformance(t, func(t *testing.T, newFeed func() typedFeed) {
+		tests := []struct {
+			name     string
+			first    func(f typedFeed)
+			second   func(f typedFeed)
+			expected error
+		}{
+			{
+				name:     "send before send",
+				first:    func(f typedFeed) { f.Send(int(0)) },
+				second:   func(f typedFeed) { f.Send(uint64(0)) },
+				expected: feedTypeError{op: "Send", got: reflect.TypeOf(uint64(0)), want: reflect.TypeOf(int(0))},
+			},
+			{
+				name:     "sub before send",
+				first:    func(f typedFeed) { f.Subscribe(make(chan int)) },
+				second:   func(f typedFeed) { f.Send(uint64(0)) },
+				expected: feedTypeError{op: "Send", got: reflect.TypeOf(uint64(0)), want: reflect.TypeOf(int(0))},
+			},
+			{
+				name:     "send before sub",
+				first:    func(f typedFeed) { f.Send(int(0)) },
+				second:   func(f typedFeed) { f.Subscribe(make(chan uint64)) },
+				expected: feedTypeError{op: "Subscribe", got: reflect.TypeOf(make(chan uint64)), want: reflect.TypeOf(make(chan<- int))},
+			},
+			{
+				name:     "sub before sub",
+				first:    func(f typedFeed) { f.Subscribe(make(chan int)) },
+				second:   func(f typedFeed) { f.Subscribe(make(chan<- uint64)) },
+				expected: feedTypeError{op: "Subscribe", got: reflect.TypeOf(make(chan<- uint64)), want: reflect.TypeOf(make(chan<- int))},
+			},
+			{
+				name:     "sub with receive-only channel",
+				first:    func(f typedFeed) {},
+				second:   func(f typedFeed) { f.Subscribe(make(<-chan int)) },
+				expected: errBadChannel,
+			},
+			{
+				name:     "sub without channel",
+				first:    func(f typedFeed) {},
+				second:   func(f typedFeed) { f.Subscribe(0) },
+				expected: errBadChannel,
+			},
+		}
+		for _, test := range tests {
+			f := newFeed()
+			test.first(f)
+			if err := panicRecover(test.expected, func() { test.second(f) }); err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+		}
+	})
+}
+
+func TestConformanceUsableAfterPanic(t *testing.T) {
+	runConformance(t, func(t *testing.T, newFeed func() typedFeed) {
+		f := newFeed()
+		ch := make(chan int, 1)
+		sub := f.Subscribe(ch)
+		defer sub.Unsubscribe()
+
+		// Rejected calls must not leave the feed locked.
+		for _, fn := range []func(){
+			func() { f.Send(uint64(0)) },
+			func() { f.Subscribe(make(chan uint64)) },
+		} {
+			func() {
+				defer func() {
+					if _, ok := recover().(feedTypeError); !ok {
+						t.Errorf("call did not panic with feedTypeError")
+					}
+				}()
+				fn()
+			}()
+		}
+
+		if nsent := f.Send(1); nsent != 1 {
+			t.Errorf("send delivered %d times, want 1", nsent)
+		}
+		if v := <-ch; v != 1 {
+			t.Errorf("received %d, want 1", v)
+		}
+	})
+}
+
+func TestConformanceSend(t *testing.T) {
+	runConformance(t, func(t *testing.T, newFeed func() typedFeed) {
+		var (
+			f     = newFeed()
+			chans = make([]chan int, 10)
+			subs  = make([]Subscription, len(chans))
+			wg    sync.WaitGroup
+		)
+		for i := range chans {
+			chans[i] = make(chan int)
+			subs[i] = f.Subscribe(chans[i])
+		}
+		wg.Add(len(chans))
+		for i, ch := range chans {
+			go func() {
+				defer wg.Done()
+				if v := <-ch; v != 1 {
+					t.Errorf("%d: received value %d, want 1", i, v)
+				}
+				subs[i].Unsubscribe()
+				if _, ok := <-subs[i].Err(); ok {
+					t.Errorf("%d: error channel not closed after unsubscribe", i)
+				}
+			}()
+		}
+		if nsent := f.Send(1); nsent != len(chans) {
+			t.Errorf("first send delivered %d times, want %d", nsent, len(chans))
+		}
+		wg.Wait()
+		if nsent := f.Send(2); nsent != 0 {
+			t.Errorf("second send delivered %d times, want 0", nsent)
+		}
+	})
+}
+
+func TestConformanceSubscribeSameChannel(t *testing.T) {
+	runConformance(t, func(t *testing.T, newFeed func() typedFeed) {
+		var (
+			f    = newFeed()
+			ch   = make(chan int, 3)
+			sub1 = f.Subscribe(ch)
+			sub2 = f.Subscribe(ch)
+		)
+		defer sub2.Unsubscribe()
+
+		if nsent := f.Send(1); nsent != 2 {
+			t.Errorf("send delivered %d times, want 2", nsent)
+		}
+		sub1.Unsubscribe()
+		if nsent := f.Send(2); nsent != 1 {
+			t.Errorf("send delivered %d times, want 1", nsent)
+		}
+		if len(ch) != 3 {
+			t.Errorf("channel holds %d values, want 3", len(ch))
+		}
+	})
+}
+
+func TestConformanceUnsubscribeBlockedSend(t *testing.T) {
+	runConformance(t, func(t *testing.T, newFeed func() typedFeed) {
+		var (
+			f     = newFeed()
+			bchan = make(chan int)
+			bsub  = f.Subscribe(bchan)
+			ch    = make(chan int, 1)
+			sub   = f.Subscribe(ch)
+			done  = make(chan int)
+		)
+		defer sub.Unsubscribe()
+
+		go func() { done <- f.Send(1) }()
+		<-ch
+		// Send is stuck on bchan until it is unsubscribed.
+		bsub.Unsubscribe()
+		if nsent := <-done; nsent != 1 {
+			t.Errorf("send delivered %d times, want 1", nsent)
+		}
+	})
+}
+
+func TestConformanceUnsubscribeSentChan(t *testing.T) {
+	runConformance(t, func(t *testing.T, newFeed func() typedFeed) {
+		var (
+			f    = newFeed()
+			ch1  = make(chan int)
+			ch2  = make(chan int)
+			sub1 = f.Subscribe(ch1)
+			sub2 = f.Subscribe(ch2)
+			done = make(chan int)
+		)
+		defer sub2.Unsubscribe()
+
+		go func() { done <- f.Send(0) }()
+		<-ch1
+		sub1.Unsubscribe()
+		<-ch2
+		if nsent := <-done; nsent != 2 {
+			t.Errorf("send delivered %d times, want 2", nsent)
+		}
+
+		go func() { done <- f.Send(0) }()
+		<-ch2
+		if nsent := <-done; nsent != 1 {
+			t.Errorf("send delivered %d times, want 1", nsent)
+		}
+	})
+}
+
+// expectClosed checks that sub has ended with ErrFeedClosed.
+func expectClosed(t *testing.T, sub Subscription) {
+	t.Helper()
+	select {
+	case err := <-sub.Err():
+		if err != ErrFeedClosed {
+			t.Errorf("Got: %v, expected error: %v", err, ErrFeedClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no error after close")
+	}
+	if _, ok := <-sub.Err(); ok {
+		t.Errorf("error channel not closed after close")
+	}
+}
+
+func TestConformanceClose(t *testing.T) {
+	runConformance(t, func(t *testing.T, newFeed func() typedFeed) {
+		var (
+			f     = newFeed()
+			ch    = make(chan int, 1)
+			sub   = f.Subscribe(ch)
+			bchan = make(chan int)
+			bsub  = f.Subscribe(bchan)
+			done  = make(chan int)
+		)
+		go func() { done <- f.Send(1) }()
+		<-ch
+
+		// Close wakes the Send blocked on bchan.
+		f.Close()
+		if nsent := <-done; nsent != 1 {
+			t.Errorf("send delivered %d times, want 1", nsent)
+		}
+		expectClosed(t, sub)
+		expectClosed(t, bsub)
+
+		if nsent := f.Send(2); nsent != 0 {
+			t.Errorf("send after close delivered %d times, want 0", nsent)
+		}
+		late := f.Subscribe(ch)
+		expectClosed(t, late)
+
+		// Ending the subscriptions again has no effect.
+		sub.Unsubscribe()
+		late.Unsubscribe()
+		f.Close()
+	})
+}
+
+func TestConformanceCloseUnused(t *testing.T) {
+	runConformance(t, func(t *testing.T, newFeed func() typedFeed) {
+		f := newFeed()
+		f.Close()
+		expectClosed(t, f.Subscribe(make(chan int)))
+		if nsent := f.Send(1); nsent != 0 {
+			t.Errorf("send after close delivered %d times, want 0", nsent)
+		}
+	})
+}
+
+func TestConformanceCloseConcurrent(t *testing.T) {
+	runConformance(t, func(t *testing.T, newFeed func() typedFeed) {
+		var (
+			f  = newFeed()
+			wg sync.WaitGroup
+		)
+		subs := make([]Subscription, 50)
+		for i := range subs {
+			subs[i] = f.Subscribe(make(chan int))
+		}
+		wg.Add(len(subs) + 10)
+		for i := 0; i < 10; i++ {
+			go func() {
+				defer wg.Done()
+				f.Send(i)
+			}()
+		}
+		for _, sub := range subs {
+			go func() {
+				defer wg.Done()
+				sub.Unsubscribe()
+			}()
+		}
+		f.Close()
+		wg.Wait()
+		for _, sub := range subs {
+			// Every subscription ended, either by Unsubscribe or by Close.
+			for range sub.Err() {
+			}
+		}
+	})
+}
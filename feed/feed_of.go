@@ -0,0 +1,233 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"slices"
+	"sync"
+)
+
+// FeedOf implements one-to-many subscriptions where the carrier of events is a channel.
+// Values sent to a FeedOf are delivered to all subscribed channels simultaneously.
+//
+// FeedOf is the type-safe counterpart of Feed. The element type is fixed at compile
+// time, so there are no run-time type checks, and values are sent with plain channel
+// operations instead of reflection.
+//
+// The zero value is ready to use.
+type FeedOf[T any] struct {
+	once      sync.Once     // ensures that init only runs once
+	sendLock  chan struct{} // sendLock has a one-element buffer and is empty when held. It protects sendChans.
+	removeSub chan chan<- T // interrupts Send
+	sendChans []chan<- T    // the active set of channels used by Send
+
+	// The inbox holds newly subscribed channels until they are added to sendChans.
+	mu    sync.Mutex
+	inbox []chan<- T
+}
+
+func (f *FeedOf[T]) init() {
+	f.removeSub = make(chan chan<- T)
+	f.sendLock = make(chan struct{}, 1)
+	f.sendLock <- struct{}{}
+}
+
+// Subscribe adds a channel to the feed. Future sends will be delivered on the channel
+// until the subscription is canceled.
+//
+// The channel should have ample buffer space to avoid blocking other subscribers.
+// Slow subscribers are not dropped.
+func (f *FeedOf[T]) Subscribe(channel chan<- T) Subscription {
+	f.once.Do(f.init)
+
+	sub := &feedOfSub[T]{feed: f, channel: channel, err: make(chan error, 1)}
+
+	// Add the channel to the inbox.
+	// The next Send will add it to f.sendChans.
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inbox = append(f.inbox, channel)
+	return sub
+}
+
+func (f *FeedOf[T]) remove(sub *feedOfSub[T]) {
+	// Delete from inbox first, which covers channels
+	// that have not been added to f.sendChans yet.
+	f.mu.Lock()
+	if index := slices.Index(f.inbox, sub.channel); index != -1 {
+		f.inbox = slices.Delete(f.inbox, index, index+1)
+		f.mu.Unlock()
+		return
+	}
+	f.mu.Unlock()
+
+	select {
+	case f.removeSub <- sub.channel:
+		// Send will remove the channel from f.sendChans.
+	case <-f.sendLock:
+		// No Send is in progress, delete the channel now that we have the send lock.
+		if index := slices.Index(f.sendChans, sub.channel); index != -1 {
+			f.sendChans = slices.Delete(f.sendChans, index, index+1)
+		}
+		f.sendLock <- struct{}{}
+	}
+}
+
+// Send delivers to all subscribed channels simultaneously.
+// It returns the number of subscribers that the value was sent to.
+func (f *FeedOf[T]) Send(value T) (nsent int) {
+	f.once.Do(f.init)
+	<-f.sendLock
+
+	// Add new channels from the inbox after taking the send lock.
+	f.mu.Lock()
+	f.sendChans = append(f.sendChans, f.inbox...)
+	f.inbox = nil
+	f.mu.Unlock()
+
+	// Send until all channels have been chosen. 'chans' tracks a prefix of
+	// sendChans. When a send succeeds, the corresponding channel moves to the
+	// end of 'chans' and it shrinks by one element.
+	chans := f.sendChans
+	for {
+		// Fast path: try sending without blocking. This should usually succeed
+		// if subscribers are fast enough and have free buffer space.
+		for i := 0; i < len(chans); i++ {
+			select {
+			case chans[i] <- value:
+				nsent++
+				chans = deactivate(chans, i)
+				i--
+			default:
+			}
+		}
+		switch len(chans) {
+		case 0:
+			// All channels have been chosen, hand off the send lock.
+			f.sendLock <- struct{}{}
+			return nsent
+		case 1:
+			// A single receiver is blocked, wait for it directly.
+			select {
+			case chans[0] <- value:
+				nsent++
+				chans = chans[:0]
+			case ch := <-f.removeSub:
+				chans = f.removeActive(ch, chans)
+			}
+		default:
+			// Several receivers are blocked, wait for all of them at once.
+			nsent += f.sendBlocked(chans, value)
+			f.sendLock <- struct{}{}
+			return nsent
+		}
+	}
+}
+
+// removeActive deletes ch from f.sendChans during Send. chans is the prefix of
+// sendChans that has not been sent to yet; the updated prefix is returned.
+//
+// note: callers must hold f.sendLock
+func (f *FeedOf[T]) removeActive(ch chan<- T, chans []chan<- T) []chan<- T {
+	index := slices.Index(f.sendChans, ch)
+	if index == -1 {
+		return chans
+	}
+	f.sendChans = slices.Delete(f.sendChans, index, index+1)
+	if index < len(chans) {
+		// Shrink 'chans' too because the removed channel was still active.
+		return f.sendChans[:len(chans)-1]
+	}
+	return chans
+}
+
+// sendBlocked delivers value to receivers that are not ready. Without a select
+// over a dynamic set of channels, every send runs in its own goroutine until it
+// succeeds or its subscription is removed. It returns the number of successful
+// sends.
+//
+// note: callers must hold f.sendLock
+func (f *FeedOf[T]) sendBlocked(chans []chan<- T, value T) (nsent int) {
+	type waiter struct {
+		ch      chan<- T
+		abort   chan struct{}
+		stopped bool // finished or aborted
+	}
+	var (
+		waiters = make([]waiter, len(chans))
+		results = make(chan int, len(chans)) // index of the waiter, negated if aborted
+	)
+	for i, ch := range chans {
+		waiters[i] = waiter{ch: ch, abort: make(chan struct{})}
+		go func(abort <-chan struct{}) {
+			select {
+			case ch <- value:
+				results <- i
+			case <-abort:
+				results <- -i - 1
+			}
+		}(waiters[i].abort)
+	}
+	for pending := len(waiters); pending > 0; {
+		select {
+		case i := <-results:
+			pending--
+			if i >= 0 {
+				nsent++
+				waiters[i].stopped = true
+			}
+		case ch := <-f.removeSub:
+			if index := slices.Index(f.sendChans, ch); index != -1 {
+				f.sendChans = slices.Delete(f.sendChans, index, index+1)
+			}
+			// Stop the send to the removed channel if it is still waiting.
+			for i := range waiters {
+				if w := &waiters[i]; w.ch == ch && !w.stopped {
+					w.stopped = true
+					close(w.abort)
+					break
+				}
+			}
+		}
+	}
+	return nsent
+}
+
+// deactivate moves the channel at index into the non-accessible portion of the chans slice.
+func deactivate[T any](chans []chan<- T, index int) []chan<- T {
+	last := len(chans) - 1
+	chans[index], chans[last] = chans[last], chans[index]
+	return chans[:last]
+}
+
+type feedOfSub[T any] struct {
+	feed    *FeedOf[T]
+	channel chan<- T
+	errOnce sync.Once
+	err     chan error
+}
+
+func (sub *feedOfSub[T]) Unsubscribe() {
+	sub.errOnce.Do(func() {
+		sub.feed.remove(sub)
+		close(sub.err)
+	})
+}
+
+func (sub *feedOfSub[T]) Err() <-chan error {
+	return sub.err
+}
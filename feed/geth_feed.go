@@ -17,12 +17,26 @@
 package feed
 
 import (
+	"context"
 	"errors"
+	"log/slog"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-var errBadChannel = errors.New("event: Subscribe argument does not have sendable channel type")
+var (
+	errBadChannel = errors.New("event: Subscribe argument does not have sendable channel type")
+	errBadMapper  = errors.New("event: SubscribeMapped argument is not a func with one parameter and one result")
+)
+
+// ErrFeedClosed is delivered on the Err channel of subscriptions that end
+// because their feed was closed.
+var ErrFeedClosed = errors.New("event: feed closed")
+
+// closeSignal is sent on removeSub by Close to interrupt a blocked Send.
+type closeSignal struct{}
 
 // Feed implements one-to-many subscriptions where the carrier of events is a channel.
 // Values sent to a Feed are delivered to all subscribed channels simultaneously.
@@ -39,9 +53,19 @@ type Feed struct {
 	sendCases caseList         // the active set of select cases used by Send
 
 	// The inbox holds newly subscribed channels until they are added to sendCases.
-	mu    sync.Mutex
-	inbox caseList
-	etype reflect.Type
+	mu      sync.Mutex
+	inbox   caseList
+	etype   reflect.Type
+	subs    []*feedSub // live subscriptions, ended by Close
+	leaving []*feedSub // unsubscribed, but their cases may still be in sendCases
+	closed  bool
+
+	// options holds, by channel, the subscriptions that have a non-default policy,
+	// a filter or a mapping. It is nil if there are none, so Send can skip the
+	// lookups.
+	options atomic.Pointer[map[interface{}]*feedSub]
+
+	leaks *LeakConfig // debugging aid, see SetLeakConfig
 }
 
 // This is the index of the first actual subscription channel in sendCases.
@@ -58,6 +82,9 @@ func (e feedTypeError) Error() string {
 }
 
 func (f *Feed) init(etype reflect.Type) {
+	// Close checks whether the feed is initialized, so take the lock.
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.etype = etype
 	f.removeSub = make(chan interface{})
 	f.sendLock = make(chan struct{}, 1)
@@ -69,66 +96,332 @@ func (f *Feed) init(etype reflect.Type) {
 // until the subscription is canceled. All channels added must have the same element type.
 //
 // The channel should have ample buffer space to avoid blocking other subscribers.
-// Slow subscribers are not dropped.
+// Slow subscribers are not dropped, see SubscribeWithPolicy for alternatives.
+//
+// Subscribing to a closed feed returns a subscription that has already ended with
+// ErrFeedClosed.
 func (f *Feed) Subscribe(channel interface{}) Subscription {
+	chanval := sendableChan(channel)
+	f.checkChannel(chanval, "Subscribe")
+	return f.add(&feedSub{feed: f, channel: chanval, err: make(chan error, 1)})
+}
+
+// SubscribeWithPolicy adds a channel to the feed like Subscribe, with policy
+// determining what Send does when the channel is not ready to receive. A channel that
+// is subscribed more than once must use the same policy every time.
+func (f *Feed) SubscribeWithPolicy(channel interface{}, policy Policy) Subscription {
+	chanval := sendableChan(channel)
+	if err := policy.validate(); err != nil {
+		panic(err)
+	}
+	f.checkChannel(chanval, "Subscribe")
+	return f.add(&feedSub{feed: f, channel: chanval, policy: policy, err: make(chan error, 1)})
+}
+
+// SubscribeFiltered adds a channel to the feed like Subscribe, but Send only delivers
+// the values for which pred returns true. Values rejected by pred do not count
+// towards the result of Send, and Send never waits for the channel to deliver them.
+//
+// pred is called by Send and must not block. The channel must not be subscribed to
+// the feed more than once.
+func (f *Feed) SubscribeFiltered(channel interface{}, pred func(interface{}) bool) Subscription {
+	chanval := sendableChan(channel)
+	f.checkChannel(chanval, "SubscribeFiltered")
+	return f.add(&feedSub{feed: f, channel: chanval, filter: pred, err: make(chan error, 1)})
+}
+
+// SubscribeMapped adds a channel to the feed like Subscribe, but Send delivers the
+// result of calling fn with the value instead of the value itself. fn must be a
+// function of type func(T) U, where T is the element type of the feed and U can be
+// sent on the channel.
+//
+// fn is called by Send and must not block. The channel must not be subscribed to the
+// feed more than once.
+func (f *Feed) SubscribeMapped(channel interface{}, fn interface{}) Subscription {
+	chanval := sendableChan(channel)
+	fnval := reflect.ValueOf(fn)
+	fntyp := fnval.Type()
+	if fntyp.Kind() != reflect.Func || fntyp.NumIn() != 1 || fntyp.NumOut() != 1 || fntyp.IsVariadic() {
+		panic(errBadMapper)
+	}
+	if elem := chanval.Type().Elem(); !fntyp.Out(0).AssignableTo(elem) {
+		panic(feedTypeError{op: "SubscribeMapped", got: fntyp.Out(0), want: elem})
+	}
+	f.once.Do(func() { f.init(fntyp.In(0)) })
+	if f.etype != fntyp.In(0) {
+		panic(feedTypeError{op: "SubscribeMapped", got: fntyp.In(0), want: f.etype})
+	}
+	return f.add(&feedSub{feed: f, channel: chanval, mapper: fnval, err: make(chan error, 1)})
+}
+
+// sendableChan returns the value of channel, which must be a sendable channel.
+func sendableChan(channel interface{}) reflect.Value {
 	chanval := reflect.ValueOf(channel)
 	chantyp := chanval.Type()
 	if chantyp.Kind() != reflect.Chan || chantyp.ChanDir()&reflect.SendDir == 0 {
 		panic(errBadChannel)
 	}
-	sub := &feedSub{feed: f, channel: chanval, err: make(chan error, 1)}
+	return chanval
+}
 
+// checkChannel initializes the feed on first use and checks that the channel
+// carries its element type.
+func (f *Feed) checkChannel(chanval reflect.Value, op string) {
+	chantyp := chanval.Type()
 	f.once.Do(func() { f.init(chantyp.Elem()) })
 	if f.etype != chantyp.Elem() {
-		panic(feedTypeError{op: "Subscribe", got: chantyp, want: reflect.ChanOf(reflect.SendDir, f.etype)})
+		panic(feedTypeError{op: op, got: chantyp, want: reflect.ChanOf(reflect.SendDir, f.etype)})
 	}
+}
 
+// add registers a new subscription. Its channel will receive values from the next Send.
+func (f *Feed) add(sub *feedSub) Subscription {
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	if f.closed {
+		sub.end(ErrFeedClosed)
+		return sub
+	}
+	if f.conflicts(sub) {
+		panic("event: channel already subscribed with different options")
+	}
+	if f.leaks != nil {
+		sub.leak = f.leaks.track()
+	}
+	f.subs = append(f.subs, sub)
+	if !sub.isDefault() {
+		f.updateOptions()
+	}
 	// Add the select case to the inbox.
 	// The next Send will add it to f.sendCases.
-	cas := reflect.SelectCase{Dir: reflect.SelectSend, Chan: chanval}
+	cas := reflect.SelectCase{Dir: reflect.SelectSend, Chan: sub.channel}
 	f.inbox = append(f.inbox, cas)
 	return sub
 }
 
+// conflicts reports whether the channel of sub is already subscribed in a way that
+// Send could not tell apart from sub. Subscriptions of the same channel may only
+// differ by their policy if they have no filter or mapping.
+//
+// note: callers must hold f.mu
+func (f *Feed) conflicts(sub *feedSub) bool {
+	ch := sub.channel.Interface()
+	if sub.isDefault() {
+		// Only channels in the options map can be subscribed differently.
+		options := f.options.Load()
+		if options == nil {
+			return false
+		}
+		_, ok := (*options)[ch]
+		return ok
+	}
+	for _, subs := range [][]*feedSub{f.subs, f.leaving} {
+		for _, s := range subs {
+			if s.channel.Interface() != ch {
+				continue
+			}
+			if s.policy != sub.policy || s.hasFuncs() || sub.hasFuncs() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// updateOptions rebuilds the options map from the live subscriptions and those
+// whose channels are still being removed from the send cases.
+//
+// note: callers must hold f.mu
+func (f *Feed) updateOptions() {
+	options := make(map[interface{}]*feedSub)
+	for _, subs := range [][]*feedSub{f.leaving, f.subs} {
+		for _, sub := range subs {
+			if !sub.isDefault() {
+				options[sub.channel.Interface()] = sub
+			}
+		}
+	}
+	if len(options) == 0 {
+		f.options.Store(nil)
+	} else {
+		f.options.Store(&options)
+	}
+}
+
+// SetLeakConfig makes the feed record where its subscriptions were created and
+// report those that look leaked: subscriptions older than config.MaxAge, and
+// subscribers that keep Send blocked for longer than config.MaxBlocked. Each
+// subscription is reported at most once for its age, and once per blocked send.
+// Tracking costs a stack trace per subscription, so it is meant for debugging.
+// It must be called before the feed is used.
+func (f *Feed) SetLeakConfig(config LeakConfig) {
+	if config.Report == nil {
+		config.Report = func(r LeakReport) {
+			slog.Warn("Possible subscription leak", "kind", r.Kind, "duration", r.Duration, "created", r.Created, "stack", r.Stack)
+		}
+	}
+	f.leaks = &config
+}
+
+// markBlocked flags the subscriptions of the given send cases as blocking, or
+// clears the flag.
+func (f *Feed) markBlocked(cases caseList, blocked bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, cas := range cases {
+		ch := cas.Chan.Interface()
+		for _, sub := range f.subs {
+			if sub.leak != nil && sub.channel.Interface() == ch {
+				sub.leak.blocking(blocked)
+			}
+		}
+	}
+}
+
 func (f *Feed) remove(sub *feedSub) {
 	// Delete from inbox first, which covers channels
 	// that have not been added to f.sendCases yet.
 	ch := sub.channel.Interface()
 	f.mu.Lock()
+	if sub.leak != nil {
+		sub.leak.untrack()
+	}
+	for i, s := range f.subs {
+		if s == sub {
+			f.subs = append(f.subs[:i:i], f.subs[i+1:]...)
+			break
+		}
+	}
 	index := f.inbox.find(ch)
 	if index != -1 {
 		f.inbox = f.inbox.delete(index)
+		if !sub.isDefault() {
+			f.updateOptions()
+		}
 		f.mu.Unlock()
 		return
 	}
+	if !sub.isDefault() {
+		f.leaving = append(f.leaving, sub)
+	}
 	f.mu.Unlock()
 
+	// The options of the channel are dropped only once its case is gone, so that
+	// Send never delivers to it without applying them.
+	if !sub.isDefault() {
+		defer func() {
+			f.mu.Lock()
+			for i, s := range f.leaving {
+				if s == sub {
+					f.leaving = append(f.leaving[:i:i], f.leaving[i+1:]...)
+					break
+				}
+			}
+			f.updateOptions()
+			f.mu.Unlock()
+		}()
+	}
+
 	select {
 	case f.removeSub <- ch:
 		// Send will remove the channel from f.sendCases.
 	case <-f.sendLock:
 		// No Send is in progress, delete the channel now that we have the send lock.
-		f.sendCases = f.sendCases.delete(f.sendCases.find(ch))
+		// The channel is already gone if the feed was closed meanwhile.
+		if index := f.sendCases.find(ch); index != -1 {
+			f.sendCases = f.sendCases.delete(index)
+		}
 		f.sendLock <- struct{}{}
 	}
 }
 
+// Close shuts down the feed. A Send blocked on slow subscribers returns, and all
+// subscriptions end: ErrFeedClosed is delivered on their Err channels, which are
+// then closed. Later calls to Send return 0 and later subscriptions end right away.
+// Close may be called concurrently with Send and Unsubscribe, and more than once.
+func (f *Feed) Close() {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return
+	}
+	f.closed = true
+	subs := f.subs
+	f.subs, f.inbox = nil, nil
+	initialized := f.sendLock != nil
+	f.mu.Unlock()
+
+	if initialized {
+		select {
+		case f.removeSub <- closeSignal{}:
+			// Send will drop all channels and return.
+		case <-f.sendLock:
+			// No Send is in progress, drop the channels now that we have the send lock.
+			f.sendCases = f.sendCases[:firstSubSendCase]
+			f.sendLock <- struct{}{}
+		}
+	}
+	// End the subscriptions once Send is out of the way, as a concurrent
+	// Unsubscribe may be waiting for it.
+	for _, sub := range subs {
+		sub.end(ErrFeedClosed)
+	}
+}
+
 // Send delivers to all subscribed channels simultaneously.
 // It returns the number of subscribers that the value was sent to.
 func (f *Feed) Send(value interface{}) (nsent int) {
+	nsent, _ = f.send(value, "Send", nil, false, false)
+	return nsent
+}
+
+// TrySend delivers to the subscribed channels that can take the value without
+// blocking. It returns the number of subscribers that the value was sent to and the
+// subscriptions that were skipped. TrySend never blocks: if another Send is in
+// progress, all subscriptions are skipped.
+func (f *Feed) TrySend(value interface{}) (nsent int, skipped []Subscription) {
+	return f.send(value, "TrySend", nil, true, true)
+}
+
+// SendContext delivers to all subscribed channels simultaneously, like Send, but
+// gives up waiting for slow subscribers when ctx is done. It returns the number of
+// subscribers that the value was sent to and the subscriptions that were skipped.
+func (f *Feed) SendContext(ctx context.Context, value interface{}) (nsent int, skipped []Subscription) {
+	return f.send(value, "SendContext", ctx.Done(), false, true)
+}
+
+// send implements Send, TrySend and SendContext. Sending stops waiting for slow
+// subscribers when done is closed, and does not wait at all if try is set. The
+// skipped subscriptions are only looked up if report is set.
+func (f *Feed) send(value interface{}, op string, done <-chan struct{}, try, report bool) (nsent int, skipped []Subscription) {
 	rvalue := reflect.ValueOf(value)
 
 	f.once.Do(func() { f.init(rvalue.Type()) })
 	if f.etype != rvalue.Type() {
-		panic(feedTypeError{op: "Send", got: rvalue.Type(), want: f.etype})
+		panic(feedTypeError{op: op, got: rvalue.Type(), want: f.etype})
 	}
 
-	<-f.sendLock
+	if try {
+		select {
+		case <-f.sendLock:
+		default:
+			return 0, f.liveSubs()
+		}
+	} else {
+		select {
+		case <-f.sendLock:
+		case <-done:
+			return 0, f.liveSubs()
+		}
+	}
 
 	// Add new cases from the inbox after taking the send lock.
 	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		f.sendLock <- struct{}{}
+		return 0, nil
+	}
 	f.sendCases = append(f.sendCases, f.inbox...)
 	f.inbox = nil
 	f.mu.Unlock()
@@ -142,48 +435,228 @@ func (f *Feed) Send(value interface{}) (nsent int) {
 	// of sendCases. When a send succeeds, the corresponding case moves to the end of
 	// 'cases' and it shrinks by one element.
 	cases := f.sendCases
+
+	// Apply the filters and mappings. Filtered out channels are deactivated
+	// right away, without counting them as sent.
+	options := f.options.Load()
+	if options != nil {
+		for i := firstSubSendCase; i < len(cases); i++ {
+			sub := (*options)[cases[i].Chan.Interface()]
+			switch {
+			case sub == nil:
+			case sub.filter != nil && !sub.filter(value):
+				cases = cases.deactivate(i)
+				i--
+			case sub.mapper.IsValid():
+				cases[i].Send = sub.mapper.Call([]reflect.Value{rvalue})[0]
+			}
+		}
+	}
+
+	var (
+		stopped  caseList      // cases that were given up on
+		evicted  []interface{} // channels whose subscriptions are evicted
+		selCases caseList      // 'cases' followed by the done and timer cases
+		timer    *time.Timer   // fires at the next eviction
+		start    time.Time
+	)
+	if options != nil {
+		start = time.Now()
+	}
+loop:
 	for {
 		// Fast path: try sending without blocking before adding to the select set.
 		// This should usually succeed if subscribers are fast enough and have free
 		// buffer space.
 		for i := firstSubSendCase; i < len(cases); i++ {
-			if cases[i].Chan.TrySend(rvalue) {
+			if cases[i].Chan.TrySend(cases[i].Send) {
 				nsent++
 				cases = cases.deactivate(i)
 				i--
+			} else if options != nil && policyOf(options, cases[i]).Slow == SlowSkip {
+				stopped = append(stopped, cases[i])
+				cases = cases.deactivate(i)
+				i--
 			}
 		}
 		if len(cases) == firstSubSendCase {
 			break
 		}
-		// Select on all the receivers, waiting for them to unblock.
-		chosen, recv, _ := reflect.Select(cases)
-		if chosen == 0 /* <-f.removeSub */ {
-			index := f.sendCases.find(recv.Interface())
-			f.sendCases = f.sendCases.delete(index)
-			if index >= 0 && index < len(cases) {
-				// Shrink 'cases' too because the removed case was still active.
+		if try {
+			stopped = append(stopped, cases[firstSubSendCase:]...)
+			break
+		}
+		// Drop the subscribers that have been waited on for too long and find
+		// out how long the others may still take.
+		wait := time.Duration(-1)
+		if options != nil {
+			elapsed := time.Since(start)
+			for i := firstSubSendCase; i < len(cases); i++ {
+				policy := policyOf(options, cases[i])
+				if policy.Slow != SlowEvict {
+					continue
+				}
+				if left := policy.Timeout - elapsed; left > 0 {
+					if wait < 0 || left < wait {
+						wait = left
+					}
+					continue
+				}
+				evicted = append(evicted, cases[i].Chan.Interface())
+				f.sendCases = f.sendCases.delete(i)
 				cases = f.sendCases[:len(cases)-1]
+				i--
+			}
+			if len(cases) == firstSubSendCase {
+				break
+			}
+		}
+		if f.leaks != nil {
+			f.markBlocked(cases[firstSubSendCase:], true)
+		}
+		// Select on all the receivers, waiting for them to unblock.
+		sel, doneCase, timerCase := cases, -1, -1
+		if done != nil || wait >= 0 {
+			if selCases == nil {
+				selCases = make(caseList, 0, len(f.sendCases)+2)
+			}
+			sel = append(selCases[:0], cases...)
+			if done != nil {
+				doneCase = len(sel)
+				sel = append(sel, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)})
+			}
+			if wait >= 0 {
+				if timer == nil {
+					timer = time.NewTimer(wait)
+					defer timer.Stop()
+				} else {
+					timer.Reset(wait)
+				}
+				timerCase = len(sel)
+				sel = append(sel, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C)})
+			}
+		}
+		chosen, recv, _ := reflect.Select(sel)
+		switch chosen {
+		case doneCase:
+			if f.leaks != nil {
+				f.markBlocked(cases[firstSubSendCase:], false)
+			}
+			stopped = append(stopped, cases[firstSubSendCase:]...)
+			break loop
+		case timerCase:
+			// Evict the subscribers whose time is up in the next iteration.
+		case 0: // <-f.removeSub
+			if recv.Interface() == (closeSignal{}) {
+				// The feed was closed, stop sending.
+				f.sendCases = f.sendCases[:firstSubSendCase]
+				break loop
+			}
+			// The channel is already gone if its subscription was evicted.
+			if index := f.sendCases.find(recv.Interface()); index != -1 {
+				f.sendCases = f.sendCases.delete(index)
+				if index < len(cases) {
+					// Shrink 'cases' too because the removed case was still active.
+					cases = f.sendCases[:len(cases)-1]
+				}
+			}
+		default:
+			if f.leaks != nil {
+				f.markBlocked(cases[chosen:chosen+1], false)
 			}
-		} else {
 			cases = cases.deactivate(chosen)
 			nsent++
 		}
 	}
+	if report && len(stopped) > 0 {
+		skipped = f.subsOf(stopped)
+	}
+	var evictedSubs []*feedSub
+	if len(evicted) > 0 {
+		evictedSubs = f.detach(evicted)
+	}
 
 	// Forget about the sent value and hand off the send lock.
 	for i := firstSubSendCase; i < len(f.sendCases); i++ {
 		f.sendCases[i].Send = reflect.Value{}
 	}
+	clear(selCases[:cap(selCases)])
 	f.sendLock <- struct{}{}
-	return nsent
+
+	for _, sub := range evictedSubs {
+		sub.end(&EvictedError{Timeout: sub.policy.Timeout})
+	}
+	return nsent, skipped
+}
+
+// policyOf returns the policy of the subscription of a send case.
+func policyOf(options *map[interface{}]*feedSub, cas reflect.SelectCase) Policy {
+	if sub := (*options)[cas.Chan.Interface()]; sub != nil {
+		return sub.policy
+	}
+	return Policy{}
+}
+
+// detach removes the subscriptions of the given channels, whose cases have already
+// been deleted by Send. Subscriptions that are being unsubscribed concurrently are
+// left to Unsubscribe.
+func (f *Feed) detach(chans []interface{}) []*feedSub {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var subs []*feedSub
+	for _, ch := range chans {
+		for i, sub := range f.subs {
+			if sub.channel.Interface() == ch {
+				f.subs = append(f.subs[:i:i], f.subs[i+1:]...)
+				subs = append(subs, sub)
+				break
+			}
+		}
+	}
+	f.updateOptions()
+	return subs
+}
+
+// liveSubs returns all subscriptions of the feed.
+func (f *Feed) liveSubs() []Subscription {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	subs := make([]Subscription, len(f.subs))
+	for i, sub := range f.subs {
+		subs[i] = sub
+	}
+	return subs
+}
+
+// subsOf returns the subscriptions of the given send cases. A channel that is
+// subscribed several times yields a different subscription for each of its cases.
+func (f *Feed) subsOf(cases caseList) []Subscription {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	subs := make([]Subscription, 0, len(cases))
+	used := make(map[*feedSub]bool, len(cases))
+	for _, cas := range cases {
+		ch := cas.Chan.Interface()
+		for _, sub := range f.subs {
+			if !used[sub] && sub.channel.Interface() == ch {
+				used[sub] = true
+				subs = append(subs, sub)
+				break
+			}
+		}
+	}
+	return subs
 }
 
 type feedSub struct {
 	feed    *Feed
 	channel reflect.Value
+	policy  Policy
+	filter  func(interface{}) bool // nil if all values are delivered
+	mapper  reflect.Value          // invalid if values are delivered as they are
 	errOnce sync.Once
 	err     chan error
+	leak    *leakEntry // set if the feed has a leak detector
 }
 
 func (sub *feedSub) Unsubscribe() {
@@ -197,6 +670,27 @@ func (sub *feedSub) Err() <-chan error {
 	return sub.err
 }
 
+// isDefault reports whether the subscription delivers all values as they are and
+// blocks Send while its channel is not ready.
+func (sub *feedSub) isDefault() bool {
+	return sub.policy == (Policy{}) && !sub.hasFuncs()
+}
+
+func (sub *feedSub) hasFuncs() bool {
+	return sub.filter != nil || sub.mapper.IsValid()
+}
+
+// end ends the subscription on behalf of the feed, delivering err.
+func (sub *feedSub) end(err error) {
+	sub.errOnce.Do(func() {
+		if sub.leak != nil {
+			sub.leak.untrack()
+		}
+		sub.err <- err
+		close(sub.err)
+	})
+}
+
 type caseList []reflect.SelectCase
 
 // find returns the index of a case containing the given channel.
@@ -17,6 +17,7 @@
 package feed
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sync"
@@ -317,6 +318,260 @@ func TestGethFeedUnsubscribeFromInbox(t *testing.T) {
 	}
 }
 
+// waitInboxDrained waits until a Send has taken the subscriptions from the inbox.
+func waitInboxDrained(feed *Feed) {
+	for {
+		feed.mu.Lock()
+		n := len(feed.inbox)
+		feed.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGethFeedTrySend(t *testing.T) {
+	var (
+		feed Feed
+		ch1  = make(chan int, 1)
+		ch2  = make(chan int)
+		sub1 = feed.Subscribe(ch1)
+		sub2 = feed.Subscribe(ch2)
+	)
+	defer sub1.Unsubscribe()
+	defer sub2.Unsubscribe()
+
+	nsent, skipped := feed.TrySend(1)
+	if nsent != 1 {
+		t.Errorf("send delivered %d times, want 1", nsent)
+	}
+	if len(skipped) != 1 || skipped[0] != sub2 {
+		t.Errorf("Got: %v, expected skipped: [%v]", skipped, sub2)
+	}
+	if v := <-ch1; v != 1 {
+		t.Errorf("received %d, want 1", v)
+	}
+}
+
+func TestGethFeedTrySendBusy(t *testing.T) {
+	var (
+		feed Feed
+		ch   = make(chan int)
+		sub  = feed.Subscribe(ch)
+		done = make(chan struct{})
+	)
+	defer sub.Unsubscribe()
+
+	go func() {
+		feed.Send(1)
+		close(done)
+	}()
+	// Wait for Send to take the send lock, then TrySend must not wait for it.
+	waitInboxDrained(&feed)
+	nsent, skipped := feed.TrySend(2)
+	if nsent != 0 || len(skipped) != 1 {
+		t.Errorf("Got: %d sent, %d skipped, expected 0 sent, 1 skipped", nsent, len(skipped))
+	}
+	<-ch
+	<-done
+}
+
+func TestGethFeedSendContext(t *testing.T) {
+	var (
+		feed Feed
+		ch1  = make(chan int)
+		ch2  = make(chan int)
+		sub1 = feed.Subscribe(ch1)
+		sub2 = feed.Subscribe(ch2)
+	)
+	defer sub1.Unsubscribe()
+	defer sub2.Unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-ch1
+		cancel()
+	}()
+	nsent, skipped := feed.SendContext(ctx, 1)
+	if nsent != 1 {
+		t.Errorf("send delivered %d times, want 1", nsent)
+	}
+	if len(skipped) != 1 || skipped[0] != sub2 {
+		t.Errorf("Got: %v, expected skipped: [%v]", skipped, sub2)
+	}
+
+	// The feed keeps working after giving up.
+	go func() { <-ch1 }()
+	go func() { <-ch2 }()
+	if nsent, skipped := feed.SendContext(context.Background(), 2); nsent != 2 || len(skipped) != 0 {
+		t.Errorf("Got: %d sent, %d skipped, expected 2 sent, 0 skipped", nsent, len(skipped))
+	}
+}
+
+func TestGethFeedSendContextWaiting(t *testing.T) {
+	var (
+		feed Feed
+		ch   = make(chan int)
+		sub  = feed.Subscribe(ch)
+		done = make(chan struct{})
+	)
+	defer sub.Unsubscribe()
+
+	go func() {
+		feed.Send(1)
+		close(done)
+	}()
+	waitInboxDrained(&feed)
+	// Another Send holds the send lock until ch is read.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if nsent, skipped := feed.SendContext(ctx, 2); nsent != 0 || len(skipped) != 1 {
+		t.Errorf("Got: %d sent, %d skipped, expected 0 sent, 1 skipped", nsent, len(skipped))
+	}
+	<-ch
+	<-done
+}
+
+func TestGethFeedSubscribeFiltered(t *testing.T) {
+	var (
+		feed Feed
+		all  = make(chan int, 10)
+		odd  = make(chan int) // never read, Send must not wait for filtered values
+		sub1 = feed.Subscribe(all)
+		sub2 = feed.SubscribeFiltered(odd, func(v interface{}) bool { return v.(int)%2 == 1 })
+		done = make(chan struct{})
+	)
+	defer sub1.Unsubscribe()
+	defer sub2.Unsubscribe()
+
+	if nsent := feed.Send(2); nsent != 1 {
+		t.Errorf("send delivered %d times, want 1", nsent)
+	}
+	go func() {
+		if v := <-odd; v != 3 {
+			t.Errorf("received %d, want 3", v)
+		}
+		close(done)
+	}()
+	if nsent := feed.Send(3); nsent != 2 {
+		t.Errorf("send delivered %d times, want 2", nsent)
+	}
+	<-done
+}
+
+func TestGethFeedSubscribeMapped(t *testing.T) {
+	var (
+		feed    Feed
+		numbers = make(chan int, 1)
+		strs    = make(chan string, 1)
+		ifaces  = make(chan fmt.Stringer, 1)
+		sub1    = feed.Subscribe(numbers)
+		sub2    = feed.SubscribeMapped(strs, func(v int) string { return fmt.Sprint(v * 2) })
+		sub3    = feed.SubscribeMapped(ifaces, func(v int) time.Duration { return time.Duration(v) * time.Second })
+	)
+	defer sub1.Unsubscribe()
+	defer sub2.Unsubscribe()
+	defer sub3.Unsubscribe()
+
+	if nsent := feed.Send(21); nsent != 3 {
+		t.Errorf("send delivered %d times, want 3", nsent)
+	}
+	if v := <-numbers; v != 21 {
+		t.Errorf("received %d, want 21", v)
+	}
+	if v := <-strs; v != "42" {
+		t.Errorf("received %q, want \"42\"", v)
+	}
+	if v := <-ifaces; v.String() != "21s" {
+		t.Errorf("received %v, want 21s", v)
+	}
+}
+
+func TestGethFeedSubscribeMappedPanics(t *testing.T) {
+	var feed Feed
+	feed.Send(0)
+
+	tests := []struct {
+		fn       interface{}
+		expected error
+	}{
+		{0, errBadMapper},
+		{func(int, int) int { return 0 }, errBadMapper},
+		{func(uint64) int { return 0 }, feedTypeError{op: "SubscribeMapped", got: reflect.TypeOf(uint64(0)), want: reflect.TypeOf(int(0))}},
+		{func(int) uint64 { return 0 }, feedTypeError{op: "SubscribeMapped", got: reflect.TypeOf(uint64(0)), want: reflect.TypeOf(int(0))}},
+	}
+	for i, test := range tests {
+		fn := func() { feed.SubscribeMapped(make(chan int), test.fn) }
+		if err := panicRecover(test.expected, fn); err != nil {
+			t.Errorf("test %d: %v", i, err)
+		}
+	}
+	// A channel with a mapping cannot be subscribed twice.
+	ch := make(chan int)
+	feed.SubscribeMapped(ch, func(v int) int { return v })
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("second subscription of mapped channel did not panic")
+			}
+		}()
+		feed.Subscribe(ch)
+	}()
+}
+
+// This test checks that Send keeps applying the filter or mapping of a channel while
+// it is being unsubscribed.
+func TestGethFeedUnsubscribeFuncsConcurrent(t *testing.T) {
+	const rounds = 200
+	var (
+		feed    Feed
+		numbers = make(chan int, 1)
+		stop    = make(chan struct{})
+		wg      sync.WaitGroup
+	)
+	sub := feed.Subscribe(numbers)
+	defer sub.Unsubscribe()
+	go func() {
+		for range numbers {
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					feed.Send(1)
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+		close(numbers)
+	}()
+
+	for i := 0; i < rounds; i++ {
+		var (
+			strs     = make(chan string, 1000)
+			rejected = make(chan int, 1000)
+			msub     = feed.SubscribeMapped(strs, func(v int) string { return fmt.Sprint(v) })
+			fsub     = feed.SubscribeFiltered(rejected, func(interface{}) bool { return false })
+		)
+		time.Sleep(10 * time.Microsecond)
+		msub.Unsubscribe()
+		fsub.Unsubscribe()
+		if len(rejected) != 0 {
+			t.Fatalf("filtered channel received %d values", len(rejected))
+		}
+	}
+}
+
 func BenchmarkGethFeedSend1000(b *testing.B) {
 	var (
 		done  sync.WaitGroup
@@ -0,0 +1,236 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// LatestFeed is a Feed that keeps the most recently sent value, and delivers it to
+// every new subscriber before the values sent after it joined. Each subscriber
+// receives the current value exactly once, followed by all later values.
+//
+// As with Feed, Subscribe never waits for a Send in progress.
+//
+// The zero value is ready to use.
+type LatestFeed struct {
+	once    sync.Once
+	feed    Feed
+	latest  atomic.Pointer[latestValue]
+	quit    chan struct{} // closed by Close
+	sendMu  sync.Mutex    // serializes Send
+	mu      sync.Mutex    // protects the fields below
+	subs    map[*latestSub]struct{}
+	pending []*latestSub // subscriptions that join the feed at the next Send
+	closed  bool
+}
+
+type latestValue struct{ v interface{} }
+
+func (l *LatestFeed) init() {
+	l.quit = make(chan struct{})
+	l.subs = make(map[*latestSub]struct{})
+}
+
+// Subscribe adds a channel to the feed. If a value has been sent, it is delivered on
+// the channel first, then all values sent later until the subscription is canceled.
+// All channels added must have the same element type.
+//
+// Delivering the current value does not block Subscribe. If the channel cannot take
+// it right away, it is delivered in the background, and the next Send waits for it.
+//
+// Subscribing to a closed feed returns a subscription that has already ended with
+// ErrFeedClosed.
+func (l *LatestFeed) Subscribe(channel interface{}) Subscription {
+	l.once.Do(l.init)
+	chanval := sendableChan(channel)
+	l.feed.checkChannel(chanval, "Subscribe")
+	sub := &latestSub{
+		feed:    l,
+		channel: chanval,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		err:     make(chan error, 1),
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		close(sub.done)
+		sub.end(ErrFeedClosed)
+		return sub
+	}
+	// The subscription receives live values from the next Send on. The value it
+	// replays is the latest one, whose Send is either done or has not yet taken
+	// the pending subscriptions.
+	l.subs[sub] = struct{}{}
+	l.pending = append(l.pending, sub)
+	latest := l.latest.Load()
+	if latest == nil {
+		close(sub.done)
+		return sub
+	}
+	value := reflect.ValueOf(latest.v)
+	if chanval.TrySend(value) {
+		close(sub.done)
+		return sub
+	}
+	go sub.replay(value, l.quit)
+	return sub
+}
+
+// Send delivers a value to all subscribed channels simultaneously and makes it the
+// current value. It returns the number of subscribers that the value has been sent
+// to. Sending to a closed feed returns 0 and does not change the current value.
+func (l *LatestFeed) Send(value interface{}) (nsent int) {
+	l.once.Do(l.init)
+	rvalue := reflect.ValueOf(value)
+	l.feed.once.Do(func() { l.feed.init(rvalue.Type()) })
+	if l.feed.etype != rvalue.Type() {
+		panic(feedTypeError{op: "Send", got: rvalue.Type(), want: l.feed.etype})
+	}
+
+	l.sendMu.Lock()
+	defer l.sendMu.Unlock()
+
+	// Subscriptions made from here on replay this value, the pending ones
+	// receive it live.
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return 0
+	}
+	l.latest.Store(&latestValue{value})
+	joining := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	for _, sub := range joining {
+		// The value they replay goes first.
+		select {
+		case <-sub.done:
+		case <-l.quit:
+			return 0
+		}
+		sub.join()
+	}
+	return l.feed.Send(value)
+}
+
+// Latest returns the current value. The boolean is false if no value has been sent.
+func (l *LatestFeed) Latest() (interface{}, bool) {
+	latest := l.latest.Load()
+	if latest == nil {
+		return nil, false
+	}
+	return latest.v, true
+}
+
+// Close ends all subscriptions of the feed, like Feed.Close. Values that were not
+// yet replayed to new subscribers are dropped.
+func (l *LatestFeed) Close() {
+	l.once.Do(l.init)
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.closed = true
+	subs := l.subs
+	l.subs, l.pending = nil, nil
+	close(l.quit)
+	l.mu.Unlock()
+
+	l.feed.Close()
+	for sub := range subs {
+		sub.end(ErrFeedClosed)
+	}
+}
+
+func (l *LatestFeed) remove(sub *latestSub) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.subs, sub)
+	for i, s := range l.pending {
+		if s == sub {
+			l.pending = append(l.pending[:i:i], l.pending[i+1:]...)
+			break
+		}
+	}
+}
+
+type latestSub struct {
+	feed     *LatestFeed
+	channel  reflect.Value
+	stop     chan struct{} // closed by Unsubscribe
+	stopOnce sync.Once
+	done     chan struct{} // closed when the current value has been replayed
+
+	mu      sync.Mutex
+	inner   Subscription // of the underlying feed, nil until joined
+	left    bool         // set by Unsubscribe
+	errOnce sync.Once
+	err     chan error
+}
+
+// replay delivers the current value in the background.
+func (sub *latestSub) replay(value reflect.Value, quit <-chan struct{}) {
+	defer close(sub.done)
+	reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: sub.channel, Send: value},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub.stop)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(quit)},
+	})
+}
+
+// join subscribes the channel to the underlying feed, unless it was unsubscribed.
+func (sub *latestSub) join() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if !sub.left {
+		sub.inner = sub.feed.feed.Subscribe(sub.channel.Interface())
+	}
+}
+
+func (sub *latestSub) Unsubscribe() {
+	sub.stopOnce.Do(func() { close(sub.stop) })
+	<-sub.done
+
+	sub.mu.Lock()
+	sub.left = true
+	inner := sub.inner
+	sub.mu.Unlock()
+	if inner != nil {
+		inner.Unsubscribe()
+	}
+	sub.feed.remove(sub)
+	sub.errOnce.Do(func() { close(sub.err) })
+}
+
+func (sub *latestSub) Err() <-chan error {
+	return sub.err
+}
+
+// end ends the subscription on behalf of the feed, delivering err.
+func (sub *latestSub) end(err error) {
+	sub.errOnce.Do(func() {
+		sub.err <- err
+		close(sub.err)
+	})
+}
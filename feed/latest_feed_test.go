@@ -0,0 +1,184 @@
+package feed
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLatestFeed(t *testing.T) {
+	var feed LatestFeed
+	if _, ok := feed.Latest(); ok {
+		t.Errorf("Latest returned a value before Send")
+	}
+
+	// Without a current value, Subscribe behaves like Feed.Subscribe.
+	ch1 := make(chan int, 2)
+	sub1 := feed.Subscribe(ch1)
+	defer sub1.Unsubscribe()
+	if nsent := feed.Send(1); nsent != 1 {
+		t.Errorf("send delivered %d times, want 1", nsent)
+	}
+	if v, ok := feed.Latest(); !ok || v != 1 {
+		t.Errorf("Latest returned %v, %t, want 1, true", v, ok)
+	}
+
+	// A buffered channel receives the current value right away.
+	ch2 := make(chan int, 2)
+	sub2 := feed.Subscribe(ch2)
+	defer sub2.Unsubscribe()
+	if len(ch2) != 1 || <-ch2 != 1 {
+		t.Errorf("current value not delivered on subscribe")
+	}
+
+	// An unbuffered channel receives it before the next value.
+	ch3 := make(chan int)
+	sub3 := feed.Subscribe(ch3)
+	defer sub3.Unsubscribe()
+	done := make(chan int)
+	go func() { done <- feed.Send(2) }()
+	if v := receive(t, ch3); v != 1 {
+		t.Errorf("received %d, want current value 1", v)
+	}
+	if v := receive(t, ch3); v != 2 {
+		t.Errorf("received %d, want 2", v)
+	}
+	if nsent := <-done; nsent != 3 {
+		t.Errorf("send delivered %d times, want 3", nsent)
+	}
+	if v := <-ch2; v != 2 {
+		t.Errorf("received %d, want 2", v)
+	}
+}
+
+func TestLatestFeedNoGap(t *testing.T) {
+	const n = 1000
+	var (
+		feed LatestFeed
+		wg   sync.WaitGroup
+	)
+	feed.Send(0)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Duration(i) * 100 * time.Microsecond)
+			ch := make(chan int, i%2)
+			sub := feed.Subscribe(ch)
+			defer sub.Unsubscribe()
+
+			// Every value from the current one on is received exactly once.
+			want := <-ch
+			for want < n {
+				if v := <-ch; v != want+1 {
+					t.Errorf("received %d after %d", v, want)
+					return
+				}
+				want++
+			}
+		}()
+	}
+	for i := 1; i <= n; i++ {
+		feed.Send(i)
+	}
+	wg.Wait()
+}
+
+func TestLatestFeedSubscribeDuringSend(t *testing.T) {
+	var (
+		feed LatestFeed
+		a    = make(chan int)
+		b    = make(chan int)
+	)
+	suba, subb := feed.Subscribe(a), feed.Subscribe(b)
+	defer suba.Unsubscribe()
+	defer subb.Unsubscribe()
+	go feed.Send(0) // joins a and b
+	receive(t, a)
+	receive(t, b)
+	go feed.Send(1)
+
+	// Send waits for b, subscribing in between must not wait for it.
+	if v := receive(t, a); v != 1 {
+		t.Errorf("received %d, want 1", v)
+	}
+	c := make(chan int, 1)
+	subscribed := make(chan Subscription)
+	go func() { subscribed <- feed.Subscribe(c) }()
+	var subc Subscription
+	select {
+	case subc = <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe waited for Send")
+	}
+	defer subc.Unsubscribe()
+	if v := receive(t, b); v != 1 {
+		t.Errorf("received %d, want 1", v)
+	}
+	// The new subscriber got the value sent before it joined, once.
+	if v := receive(t, c); v != 1 {
+		t.Errorf("received %d, want 1", v)
+	}
+	go feed.Send(2)
+	for _, ch := range []chan int{a, b, c} {
+		if v := receive(t, ch); v != 2 {
+			t.Errorf("received %d, want 2", v)
+		}
+	}
+}
+
+func TestLatestFeedUnsubscribe(t *testing.T) {
+	var feed LatestFeed
+	feed.Send(1)
+
+	// Nobody reads ch, unsubscribing must stop the replay so Send does not wait.
+	ch := make(chan int)
+	sub := feed.Subscribe(ch)
+	sub.Unsubscribe()
+	if nsent := feed.Send(2); nsent != 0 {
+		t.Errorf("send delivered %d times, want 0", nsent)
+	}
+}
+
+func TestLatestFeedClose(t *testing.T) {
+	var feed LatestFeed
+	feed.Send(1)
+
+	ch := make(chan int)
+	sub := feed.Subscribe(ch)
+	defer sub.Unsubscribe()
+	feed.Close()
+
+	if err := receive(t, sub.Err()); err != ErrFeedClosed {
+		t.Errorf("Got: %v, expected error: %v", err, ErrFeedClosed)
+	}
+	if nsent := feed.Send(2); nsent != 0 {
+		t.Errorf("send delivered %d times after Close, want 0", nsent)
+	}
+	if v, _ := feed.Latest(); v != 1 {
+		t.Errorf("Latest returned %v after Close, want 1", v)
+	}
+	late := feed.Subscribe(make(chan int, 1))
+	if err := receive(t, late.Err()); err != ErrFeedClosed {
+		t.Errorf("Got: %v, expected error: %v", err, ErrFeedClosed)
+	}
+}
+
+func TestLatestFeedTypeCheck(t *testing.T) {
+	var feed LatestFeed
+	feed.Send(1)
+
+	defer func() {
+		if _, ok := recover().(feedTypeError); !ok {
+			t.Errorf("Subscribe with wrong channel type did not panic")
+		}
+		// The feed remains usable.
+		ch := make(chan int, 1)
+		sub := feed.Subscribe(ch)
+		defer sub.Unsubscribe()
+		if v := <-ch; v != 1 {
+			t.Errorf("received %d, want 1", v)
+		}
+	}()
+	feed.Subscribe(make(chan string, 1))
+}
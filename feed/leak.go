@@ -0,0 +1,127 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// LeakKind describes why a subscription was reported.
+type LeakKind int
+
+const (
+	// LeakAge is reported for subscriptions live for longer than LeakConfig.MaxAge.
+	LeakAge LeakKind = iota
+	// LeakBlocked is reported for subscribers that have kept Send waiting for
+	// longer than LeakConfig.MaxBlocked.
+	LeakBlocked
+)
+
+func (k LeakKind) String() string {
+	switch k {
+	case LeakAge:
+		return "old subscription"
+	case LeakBlocked:
+		return "blocked subscriber"
+	default:
+		return fmt.Sprintf("LeakKind(%d)", int(k))
+	}
+}
+
+// LeakReport describes a suspicious subscription.
+type LeakReport struct {
+	Kind     LeakKind
+	Created  time.Time     // when the subscription was created
+	Duration time.Duration // age of the subscription, or how long it has been blocking
+	Stack    string        // stack trace of the Subscribe call
+}
+
+func (r LeakReport) String() string {
+	return fmt.Sprintf("event: %v after %v, subscribed at:\n%s", r.Kind, r.Duration, r.Stack)
+}
+
+// LeakConfig enables leak reports for a Feed, see Feed.SetLeakConfig.
+type LeakConfig struct {
+	MaxAge     time.Duration    // report subscriptions older than this, zero disables
+	MaxBlocked time.Duration    // report subscribers blocking Send longer than this, zero disables
+	Report     func(LeakReport) // receives reports, defaults to logging them with slog
+}
+
+// leakEntry records where a subscription was created, and reports it once it
+// gets too old or keeps a send blocked for too long.
+type leakEntry struct {
+	config  *LeakConfig
+	created time.Time
+	stack   string
+
+	mu      sync.Mutex
+	ended   bool
+	age     *time.Timer // nil if ages are not reported
+	blocked *time.Timer // set while a send is blocked on the subscriber
+}
+
+// track starts tracking a subscription created by the caller.
+func (c *LeakConfig) track() *leakEntry {
+	e := &leakEntry{config: c, created: time.Now(), stack: string(debug.Stack())}
+	if c.MaxAge > 0 {
+		e.age = time.AfterFunc(c.MaxAge, func() {
+			c.Report(e.report(LeakAge, time.Since(e.created)))
+		})
+	}
+	return e
+}
+
+// untrack stops tracking a subscription that has ended.
+func (e *leakEntry) untrack() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ended = true
+	if e.age != nil {
+		e.age.Stop()
+	}
+	if e.blocked != nil {
+		e.blocked.Stop()
+		e.blocked = nil
+	}
+}
+
+// blocking marks the start and end of a send that may block. Marking an
+// already blocked subscription keeps the original start time.
+func (e *leakEntry) blocking(blocked bool) {
+	if e.config.MaxBlocked <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch {
+	case blocked && e.blocked == nil && !e.ended:
+		start := time.Now()
+		e.blocked = time.AfterFunc(e.config.MaxBlocked, func() {
+			e.config.Report(e.report(LeakBlocked, time.Since(start)))
+		})
+	case !blocked && e.blocked != nil:
+		e.blocked.Stop()
+		e.blocked = nil
+	}
+}
+
+func (e *leakEntry) report(kind LeakKind, d time.Duration) LeakReport {
+	return LeakReport{Kind: kind, Created: e.created, Duration: d, Stack: e.stack}
+}
@@ -0,0 +1,78 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLeakConfig(config LeakConfig) (LeakConfig, chan LeakReport) {
+	reports := make(chan LeakReport, 10)
+	config.Report = func(r LeakReport) { reports <- r }
+	return config, reports
+}
+
+func TestLeakAge(t *testing.T) {
+	config, reports := newTestLeakConfig(LeakConfig{MaxAge: 20 * time.Millisecond})
+
+	var feed Feed
+	feed.SetLeakConfig(config)
+	feed.Subscribe(make(chan int)).Unsubscribe()
+	sub := feed.Subscribe(make(chan int)) // leaked
+	defer sub.Unsubscribe()
+
+	select {
+	case r := <-reports:
+		if r.Kind != LeakAge {
+			t.Errorf("Got report kind %v, expected %v", r.Kind, LeakAge)
+		}
+		if !strings.Contains(r.Stack, "TestLeakAge") {
+			t.Errorf("Report stack does not contain the subscribing function:\n%s", r.Stack)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No report for old subscription")
+	}
+	// The subscription that ended is not reported.
+	select {
+	case r := <-reports:
+		t.Errorf("Unexpected report: %v", r)
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+func TestLeakBlocked(t *testing.T) {
+	config, reports := newTestLeakConfig(LeakConfig{MaxBlocked: 20 * time.Millisecond})
+
+	var (
+		feed    Feed
+		fast    = make(chan int, 1)
+		blocked = make(chan int)
+	)
+	feed.SetLeakConfig(config)
+	fastSub := feed.Subscribe(fast)
+	defer fastSub.Unsubscribe()
+	blockedSub := feed.Subscribe(blocked)
+	defer blockedSub.Unsubscribe()
+
+	done := make(chan int)
+	go func() { done <- feed.Send(1) }()
+
+	select {
+	case r := <-reports:
+		if r.Kind != LeakBlocked || r.Duration < 20*time.Millisecond {
+			t.Errorf("Got report %v after %v, expected %v", r.Kind, r.Duration, LeakBlocked)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No report for blocked subscriber")
+	}
+	// Only the blocking subscriber is reported.
+	select {
+	case r := <-reports:
+		t.Errorf("Unexpected report: %v", r)
+	case <-time.After(30 * time.Millisecond):
+	}
+	<-blocked
+	if n := <-done; n != 2 {
+		t.Errorf("Send delivered %d times, want 2", n)
+	}
+}
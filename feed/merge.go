@@ -0,0 +1,134 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import "sync"
+
+// Tagged is a value received by Merge, together with the input it came from.
+type Tagged struct {
+	Input int         // index of the input in the Merge call
+	Value interface{} // the received value
+}
+
+// MergeInput is an input of Merge. It is created by Input or InputSub.
+type MergeInput interface {
+	// start subscribes to the input. The returned function forwards its values until
+	// stop is closed or the subscription ends, and then reports the result on errc.
+	start() (forward func(index int, out chan<- Tagged, stop <-chan struct{}, errc chan<- error))
+}
+
+// Input returns a Merge input that subscribes to src.
+func Input[T any](src Source[T]) MergeInput {
+	return sourceInput[T]{src}
+}
+
+// InputSub returns a Merge input for an established subscription that delivers its
+// values on ch. Merge takes ownership of sub and unsubscribes it when it ends.
+func InputSub[T any](ch <-chan T, sub Subscription) MergeInput {
+	return subInput[T]{ch, sub}
+}
+
+type sourceInput[T any] struct{ src Source[T] }
+
+func (in sourceInput[T]) start() func(int, chan<- Tagged, <-chan struct{}, chan<- error) {
+	ch := make(chan T, operatorBuffer)
+	return subInput[T]{ch, in.src.Subscribe(ch)}.start()
+}
+
+type subInput[T any] struct {
+	ch  <-chan T
+	sub Subscription
+}
+
+func (in subInput[T]) start() func(int, chan<- Tagged, <-chan struct{}, chan<- error) {
+	return in.forward
+}
+
+func (in subInput[T]) forward(index int, out chan<- Tagged, stop <-chan struct{}, errc chan<- error) {
+	defer in.sub.Unsubscribe()
+
+	deliver := func(v T) bool {
+		select {
+		case out <- Tagged{Input: index, Value: v}:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	for {
+		select {
+		case v := <-in.ch:
+			if !deliver(v) {
+				return
+			}
+		case err := <-in.sub.Err():
+			// Values received before the subscription ended are still delivered.
+			for len(in.ch) > 0 {
+				if !deliver(<-in.ch) {
+					return
+				}
+			}
+			errc <- err
+			return
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Merge subscribes to all inputs and delivers their values on channel, tagged with the
+// index of the input they came from. The inputs may have different value types.
+//
+// The returned subscription ends when all inputs have ended. If an input fails, the
+// others are unsubscribed and its error is delivered on the Err channel. Unsubscribe
+// unsubscribes all inputs.
+func Merge(channel chan<- Tagged, inputs ...MergeInput) Subscription {
+	forwards := make([]func(int, chan<- Tagged, <-chan struct{}, chan<- error), len(inputs))
+	// Inputs are subscribed before Merge returns, so that no value sent after it
+	// is missed.
+	for i, in := range inputs {
+		forwards[i] = in.start()
+	}
+	return NewSubscription(func(quit <-chan struct{}) error {
+		var (
+			stop = make(chan struct{})
+			errc = make(chan error, len(inputs))
+			wg   sync.WaitGroup
+		)
+		for i, forward := range forwards {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				forward(i, channel, stop, errc)
+			}()
+		}
+		defer wg.Wait()
+		defer close(stop)
+
+		for ended := 0; ended < len(inputs); ended++ {
+			select {
+			case err := <-errc:
+				if err != nil {
+					return err
+				}
+			case <-quit:
+				return nil
+			}
+		}
+		return nil
+	})
+}
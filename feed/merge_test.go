@@ -0,0 +1,118 @@
+package feed
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	var (
+		ints    FeedOf[int]
+		strs    Feed
+		extra   = make(chan bool, 1)
+		extraFn = NewSubscription(func(quit <-chan struct{}) error {
+			extra <- true
+			<-quit
+			return nil
+		})
+		out = make(chan Tagged, 10)
+	)
+	sub := Merge(out, Input[int](&ints), Input(SourceOf[string](&strs)), InputSub(extra, extraFn))
+	defer sub.Unsubscribe()
+
+	if nsent := ints.Send(1); nsent != 1 {
+		t.Errorf("send delivered %d times, want 1", nsent)
+	}
+	if nsent := strs.Send("a"); nsent != 1 {
+		t.Errorf("send delivered %d times, want 1", nsent)
+	}
+	got := make(map[Tagged]bool)
+	for i := 0; i < 3; i++ {
+		got[receive(t, out)] = true
+	}
+	for _, want := range []Tagged{{0, 1}, {1, "a"}, {2, true}} {
+		if !got[want] {
+			t.Errorf("missing value %v, got %v", want, got)
+		}
+	}
+}
+
+func TestMergeErr(t *testing.T) {
+	var (
+		ints  FeedOf[int]
+		errs  = make(chan int)
+		fail  = errors.New("input failed")
+		ready = make(chan struct{})
+		out   = make(chan Tagged)
+	)
+	failing := NewSubscription(func(quit <-chan struct{}) error {
+		select {
+		case <-ready:
+			return fail
+		case <-quit:
+			return nil
+		}
+	})
+	sub := Merge(out, Input[int](&ints), InputSub(errs, failing))
+	close(ready)
+
+	if err := receive(t, sub.Err()); err != fail {
+		t.Errorf("Got: %v, expected error: %v", err, fail)
+	}
+	// The error ends the other inputs.
+	if nsent := ints.Send(1); nsent != 0 {
+		t.Errorf("send delivered %d times after error, want 0", nsent)
+	}
+	sub.Unsubscribe()
+}
+
+func TestMergeUnsubscribe(t *testing.T) {
+	var (
+		a, b FeedOf[int]
+		out  = make(chan Tagged)
+	)
+	sub := Merge(out, Input[int](&a), Input[int](&b))
+
+	// Nobody reads out, the merge is blocked delivering a value.
+	a.Send(1)
+	done := make(chan struct{})
+	go func() {
+		sub.Unsubscribe()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Unsubscribe blocked")
+	}
+	if _, ok := <-sub.Err(); ok {
+		t.Errorf("error channel not closed")
+	}
+	if nsent := a.Send(2) + b.Send(2); nsent != 0 {
+		t.Errorf("send delivered %d times after Unsubscribe, want 0", nsent)
+	}
+}
+
+func TestMergeEnd(t *testing.T) {
+	var (
+		ch   = make(chan int)
+		done = NewSubscription(func(<-chan struct{}) error { return nil })
+		out  = make(chan Tagged)
+	)
+	// A merge ends successfully once all its inputs have ended.
+	sub := Merge(out, InputSub(ch, done), InputSub(ch, done))
+	if _, ok := <-sub.Err(); ok {
+		t.Errorf("error channel not closed")
+	}
+	sub.Unsubscribe()
+
+	// Closing a Feed ends its input with ErrFeedClosed.
+	var f Feed
+	sub = Merge(out, InputSub(ch, done), Input(SourceOf[int](&f)))
+	defer sub.Unsubscribe()
+	f.Close()
+	if err := receive(t, sub.Err()); err != ErrFeedClosed {
+		t.Errorf("Got: %v, expected error: %v", err, ErrFeedClosed)
+	}
+}
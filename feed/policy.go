@@ -0,0 +1,81 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"fmt"
+	"time"
+)
+
+// SlowAction is what Send does with a subscriber that is not ready to receive.
+type SlowAction int
+
+const (
+	// SlowBlock makes Send wait for the subscriber. This is the behaviour of
+	// Subscribe.
+	SlowBlock SlowAction = iota
+	// SlowSkip makes Send skip the subscriber if its channel cannot take the
+	// value right away. The subscriber misses the value.
+	SlowSkip
+	// SlowEvict makes Send wait up to Policy.Timeout for the subscriber, then end
+	// the subscription with an *EvictedError.
+	SlowEvict
+)
+
+func (a SlowAction) String() string {
+	switch a {
+	case SlowBlock:
+		return "block"
+	case SlowSkip:
+		return "skip"
+	case SlowEvict:
+		return "evict"
+	default:
+		return fmt.Sprintf("SlowAction(%d)", int(a))
+	}
+}
+
+// Policy configures how a Feed treats a slow subscriber.
+type Policy struct {
+	Slow    SlowAction
+	Timeout time.Duration // how long Send waits before evicting, for SlowEvict
+}
+
+func (p Policy) validate() error {
+	switch p.Slow {
+	case SlowBlock, SlowSkip:
+		return nil
+	case SlowEvict:
+		if p.Timeout <= 0 {
+			return fmt.Errorf("event: invalid eviction timeout %v", p.Timeout)
+		}
+		return nil
+	default:
+		return fmt.Errorf("event: invalid slow subscriber action %v", p.Slow)
+	}
+}
+
+// EvictedError is delivered on the Err channel of a subscription that was ended
+// because its subscriber did not receive a value within the timeout of its policy.
+// The owner may subscribe again, for example through Resubscribe.
+type EvictedError struct {
+	Timeout time.Duration
+}
+
+func (e *EvictedError) Error() string {
+	return fmt.Sprintf("event: subscriber evicted after not receiving for %v", e.Timeout)
+}
@@ -0,0 +1,147 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFeedSkipPolicy(t *testing.T) {
+	var (
+		feed  Feed
+		ch    = make(chan int, 1)
+		sub   = feed.Subscribe(ch)
+		slow  = make(chan int)
+		ssub  = feed.SubscribeWithPolicy(slow, Policy{Slow: SlowSkip})
+		ready = make(chan int, 1)
+		rsub  = feed.SubscribeWithPolicy(ready, Policy{Slow: SlowSkip})
+	)
+	defer sub.Unsubscribe()
+	defer ssub.Unsubscribe()
+	defer rsub.Unsubscribe()
+
+	// Nobody reads slow, Send must not wait for it.
+	if nsent := feed.Send(1); nsent != 2 {
+		t.Errorf("send delivered %d times, want 2", nsent)
+	}
+	if v := <-ready; v != 1 {
+		t.Errorf("received %d, want 1", v)
+	}
+	<-ch
+
+	nsent, skipped := feed.SendContext(context.Background(), 2)
+	if nsent != 2 {
+		t.Errorf("send delivered %d times, want 2", nsent)
+	}
+	if len(skipped) != 1 || skipped[0] != ssub {
+		t.Errorf("Got: %v, expected skipped: [%v]", skipped, ssub)
+	}
+}
+
+func TestFeedEvictPolicy(t *testing.T) {
+	var (
+		feed Feed
+		ch   = make(chan int, 2)
+		sub  = feed.Subscribe(ch)
+		slow = make(chan int)
+		ssub = feed.SubscribeWithPolicy(slow, Policy{Slow: SlowEvict, Timeout: 20 * time.Millisecond})
+	)
+	defer sub.Unsubscribe()
+
+	start := time.Now()
+	if nsent := feed.Send(1); nsent != 1 {
+		t.Errorf("send delivered %d times, want 1", nsent)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("send returned after %v, before the eviction timeout", elapsed)
+	}
+	var evicted *EvictedError
+	if err := <-ssub.Err(); !errors.As(err, &evicted) || evicted.Timeout != 20*time.Millisecond {
+		t.Errorf("Got: %v, expected eviction error", err)
+	}
+	if _, ok := <-ssub.Err(); ok {
+		t.Errorf("error channel not closed after eviction")
+	}
+	ssub.Unsubscribe()
+
+	// The evicted channel no longer receives.
+	if nsent := feed.Send(2); nsent != 1 {
+		t.Errorf("send delivered %d times, want 1", nsent)
+	}
+	if len(feed.subs) != 1 || feed.options.Load() != nil {
+		t.Errorf("evicted subscription was not removed")
+	}
+}
+
+func TestFeedEvictPolicyReceiving(t *testing.T) {
+	var (
+		feed Feed
+		ch   = make(chan int)
+		sub  = feed.SubscribeWithPolicy(ch, Policy{Slow: SlowEvict, Timeout: time.Second})
+	)
+	defer sub.Unsubscribe()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-ch
+	}()
+	if nsent := feed.Send(1); nsent != 1 {
+		t.Errorf("send delivered %d times, want 1", nsent)
+	}
+	select {
+	case err := <-sub.Err():
+		t.Errorf("subscription ended with %v", err)
+	default:
+	}
+}
+
+func TestFeedEvictResubscribe(t *testing.T) {
+	var (
+		feed Feed
+		ch   = make(chan int)
+		subs = make(chan struct{}, 10)
+	)
+	sub := Resubscribe(time.Second, func(context.Context) (Subscription, error) {
+		subs <- struct{}{}
+		return feed.SubscribeWithPolicy(ch, Policy{Slow: SlowEvict, Timeout: 10 * time.Millisecond}), nil
+	})
+	defer sub.Unsubscribe()
+
+	<-subs
+	if nsent := feed.Send(1); nsent != 0 {
+		t.Errorf("send delivered %d times, want 0", nsent)
+	}
+	// The eviction makes Resubscribe subscribe again.
+	select {
+	case <-subs:
+	case <-time.After(time.Second):
+		t.Fatal("no resubscription after eviction")
+	}
+	go feed.Send(2)
+	if v := <-ch; v != 2 {
+		t.Errorf("received %d, want 2", v)
+	}
+}
+
+func TestFeedPolicyInvalid(t *testing.T) {
+	var feed Feed
+	ch := make(chan int)
+	feed.SubscribeWithPolicy(ch, Policy{Slow: SlowSkip})
+
+	for _, fn := range []func(){
+		func() { feed.SubscribeWithPolicy(make(chan int), Policy{Slow: SlowEvict}) },
+		func() { feed.SubscribeWithPolicy(make(chan int), Policy{Slow: SlowAction(10)}) },
+		func() { feed.Subscribe(ch) },
+		func() { feed.SubscribeWithPolicy(ch, Policy{Slow: SlowEvict, Timeout: time.Second}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("SubscribeWithPolicy did not panic")
+				}
+			}()
+			fn()
+		}()
+	}
+}
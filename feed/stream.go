@@ -0,0 +1,409 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package feed
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// operatorBuffer is the channel capacity an operator subscribes to its source with.
+const operatorBuffer = 16
+
+// errSourceDone is returned by an operator whose source subscription ended without
+// an error.
+var errSourceDone = errors.New("event: source subscription ended")
+
+// Source is a feed of values of type T. *FeedOf[T] and the derived feeds returned
+// by the stream operators are sources; SourceOf adapts a Feed.
+type Source[T any] interface {
+	Subscribe(channel chan<- T) Subscription
+}
+
+// SourceOf returns a Feed as a source of values of type T.
+func SourceOf[T any](f *Feed) Source[T] {
+	return feedSource[T]{f}
+}
+
+type feedSource[T any] struct{ feed *Feed }
+
+func (s feedSource[T]) Subscribe(channel chan<- T) Subscription {
+	return s.feed.Subscribe(channel)
+}
+
+// DerivedFeed is a feed whose values are computed from another feed by a stream
+// operator such as Map or Batch.
+//
+// The operator subscribes to its source when the first subscriber arrives, and
+// unsubscribes again when the last one leaves. If the source subscription fails,
+// the error is delivered on the Err channel of every subscription of the derived
+// feed, which then end. A later Subscribe starts over with a new source subscription.
+type DerivedFeed[T any] struct {
+	out   FeedOf[T]
+	start func() operator[T] // subscribes to the source
+
+	runMu sync.Mutex // serializes starting and stopping the operator
+	mu    sync.Mutex // protects the fields below
+	subs  map[*derivedSub[T]]struct{}
+	quit  chan struct{} // stops the operator, nil if it is not running
+	done  chan struct{} // closed when the operator has stopped
+}
+
+// operator runs a stream operator until quit is closed or its source fails. It
+// passes its results to send.
+type operator[T any] func(quit <-chan struct{}, send func(T)) error
+
+func newDerived[T any](start func() operator[T]) *DerivedFeed[T] {
+	return &DerivedFeed[T]{start: start, subs: make(map[*derivedSub[T]]struct{})}
+}
+
+// Subscribe adds a channel to the feed. Future values will be delivered on the
+// channel until the subscription is canceled.
+//
+// The channel should have ample buffer space, a slow subscriber holds up the
+// operator and all other subscribers.
+//
+// If the operator is not running, Subscribe starts it, subscribing to the source
+// before it returns. Values sent on the source after that are not missed.
+func (f *DerivedFeed[T]) Subscribe(channel chan<- T) Subscription {
+	f.runMu.Lock()
+	defer f.runMu.Unlock()
+
+	sub := &derivedSub[T]{feed: f, sub: f.out.Subscribe(channel), err: make(chan error, 1)}
+	f.mu.Lock()
+	if f.quit != nil {
+		// The operator is running. Adding the subscription under the same lock
+		// ensures loop ends it if the source fails.
+		f.subs[sub] = struct{}{}
+		f.mu.Unlock()
+		return sub
+	}
+	f.mu.Unlock()
+
+	// Start the operator. This may panic, for example if the source has another
+	// element type, so nothing has been changed yet.
+	run := f.startOperator(sub)
+	f.mu.Lock()
+	f.subs[sub] = struct{}{}
+	f.quit, f.done = make(chan struct{}), make(chan struct{})
+	quit, done := f.quit, f.done
+	f.mu.Unlock()
+
+	go f.loop(run, quit, done)
+	return sub
+}
+
+// startOperator subscribes the operator to its source. The output subscription of
+// sub is released if that fails.
+func (f *DerivedFeed[T]) startOperator(sub *derivedSub[T]) operator[T] {
+	ok := false
+	defer func() {
+		if !ok {
+			sub.sub.Unsubscribe()
+		}
+	}()
+	run := f.start()
+	ok = true
+	return run
+}
+
+// loop runs the operator until it is stopped or its source fails.
+func (f *DerivedFeed[T]) loop(run operator[T], quit, done chan struct{}) {
+	defer close(done)
+	err := run(quit, func(v T) { f.out.Send(v) })
+	if err == nil {
+		return
+	}
+	// The source failed, end all subscriptions.
+	f.mu.Lock()
+	if f.quit == quit {
+		f.quit = nil
+	}
+	subs := f.subs
+	f.subs = make(map[*derivedSub[T]]struct{})
+	f.mu.Unlock()
+
+	if err == errSourceDone {
+		err = nil
+	}
+	for sub := range subs {
+		sub.end(err)
+	}
+}
+
+// release removes an unsubscribed subscription and stops the operator if it was
+// the last one.
+func (f *DerivedFeed[T]) release(sub *derivedSub[T]) {
+	f.runMu.Lock()
+	defer f.runMu.Unlock()
+
+	f.mu.Lock()
+	delete(f.subs, sub)
+	var quit, done chan struct{}
+	if len(f.subs) == 0 && f.quit != nil {
+		quit, done = f.quit, f.done
+		f.quit = nil
+	}
+	f.mu.Unlock()
+
+	if quit != nil {
+		close(quit)
+		<-done
+	}
+}
+
+type derivedSub[T any] struct {
+	feed    *DerivedFeed[T]
+	sub     Subscription // subscription of the output feed
+	errOnce sync.Once
+	err     chan error
+}
+
+func (sub *derivedSub[T]) Unsubscribe() {
+	sub.errOnce.Do(func() {
+		sub.sub.Unsubscribe()
+		sub.feed.release(sub)
+		close(sub.err)
+	})
+}
+
+func (sub *derivedSub[T]) Err() <-chan error {
+	return sub.err
+}
+
+// end ends the subscription because the source failed, delivering err if not nil.
+func (sub *derivedSub[T]) end(err error) {
+	sub.errOnce.Do(func() {
+		sub.sub.Unsubscribe()
+		if err != nil {
+			sub.err <- err
+		}
+		close(sub.err)
+	})
+}
+
+// input is the subscription of an operator to its source.
+type input[T any] struct {
+	ch  chan T
+	sub Subscription
+}
+
+func subscribeInput[T any](src Source[T]) *input[T] {
+	ch := make(chan T, operatorBuffer)
+	return &input[T]{ch: ch, sub: src.Subscribe(ch)}
+}
+
+// pump passes the values of the input to onValue until quit is closed or the
+// subscription fails, and then unsubscribes. If timer is not nil, onTimer is
+// called whenever the channel it returns fires. When the subscription fails, the
+// values still buffered are handled and onEnd, if not nil, is called before the
+// error is returned.
+func (in *input[T]) pump(quit <-chan struct{}, onValue func(T), timer func() <-chan time.Time, onTimer, onEnd func()) error {
+	defer in.sub.Unsubscribe()
+
+	var timerC <-chan time.Time
+	for {
+		if timer != nil {
+			timerC = timer()
+		}
+		select {
+		case v := <-in.ch:
+			onValue(v)
+		case <-timerC:
+			onTimer()
+		case err, ok := <-in.sub.Err():
+			for len(in.ch) > 0 {
+				onValue(<-in.ch)
+			}
+			if onEnd != nil {
+				onEnd()
+			}
+			if !ok || err == nil {
+				return errSourceDone
+			}
+			return err
+		case <-quit:
+			return nil
+		}
+	}
+}
+
+// Map returns a feed of the results of calling fn on every value of src.
+func Map[T, U any](src Source[T], fn func(T) U) *DerivedFeed[U] {
+	return newDerived(func() operator[U] {
+		in := subscribeInput(src)
+		return func(quit <-chan struct{}, send func(U)) error {
+			return in.pump(quit, func(v T) { send(fn(v)) }, nil, nil, nil)
+		}
+	})
+}
+
+// Filter returns a feed of the values of src for which pred returns true.
+func Filter[T any](src Source[T], pred func(T) bool) *DerivedFeed[T] {
+	return newDerived(func() operator[T] {
+		in := subscribeInput(src)
+		return func(quit <-chan struct{}, send func(T)) error {
+			return in.pump(quit, func(v T) {
+				if pred(v) {
+					send(v)
+				}
+			}, nil, nil, nil)
+		}
+	})
+}
+
+// Batch returns a feed that groups the values of src into slices of up to size
+// values. A batch is sent when it is full, or when interval has passed since its
+// first value was received. An interval of zero waits for full batches. If the
+// source fails, the pending batch is sent before the error is delivered.
+func Batch[T any](src Source[T], size int, interval time.Duration) *DerivedFeed[[]T] {
+	if size < 1 {
+		panic(fmt.Sprintf("event: invalid batch size %d", size))
+	}
+	return newDerived(func() operator[[]T] {
+		in := subscribeInput(src)
+		return func(quit <-chan struct{}, send func([]T)) error {
+			var (
+				batch []T
+				t     = newStreamTimer()
+			)
+			defer t.stop()
+			flush := func() {
+				t.stop()
+				if len(batch) > 0 {
+					send(batch)
+					batch = nil
+				}
+			}
+			onValue := func(v T) {
+				batch = append(batch, v)
+				if len(batch) == 1 && interval > 0 {
+					t.start(interval)
+				}
+				if len(batch) >= size {
+					flush()
+				}
+			}
+			return in.pump(quit, onValue, t.channel, flush, flush)
+		}
+	})
+}
+
+// Debounce returns a feed that sends the latest value of src once src has been
+// quiet for d. Values followed by another value within d are dropped. If the source
+// fails, the pending value is sent before the error is delivered.
+func Debounce[T any](src Source[T], d time.Duration) *DerivedFeed[T] {
+	return newDerived(func() operator[T] {
+		in := subscribeInput(src)
+		return func(quit <-chan struct{}, send func(T)) error {
+			var (
+				latest T
+				t      = newStreamTimer()
+			)
+			defer t.stop()
+			onValue := func(v T) {
+				latest = v
+				t.start(d)
+			}
+			flush := func() {
+				if t.running() {
+					t.stop()
+					send(latest)
+				}
+			}
+			return in.pump(quit, onValue, t.channel, flush, flush)
+		}
+	})
+}
+
+// Throttle returns a feed that sends at most one value of src per period d. The
+// first value is sent right away and starts a period. Of the values received during
+// a period, only the latest is kept and sent when the period ends, starting the
+// next one. If the source fails, the pending value is sent before the error is
+// delivered.
+func Throttle[T any](src Source[T], d time.Duration) *DerivedFeed[T] {
+	return newDerived(func() operator[T] {
+		in := subscribeInput(src)
+		return func(quit <-chan struct{}, send func(T)) error {
+			var (
+				latest  T
+				pending bool
+				t       = newStreamTimer()
+			)
+			defer t.stop()
+			onValue := func(v T) {
+				if !t.running() {
+					send(v)
+					t.start(d)
+				} else {
+					latest, pending = v, true
+				}
+			}
+			onTimer := func() {
+				t.stop()
+				if pending {
+					send(latest)
+					pending = false
+					t.start(d)
+				}
+			}
+			onEnd := func() {
+				if pending {
+					send(latest)
+				}
+			}
+			return in.pump(quit, onValue, t.channel, onTimer, onEnd)
+		}
+	})
+}
+
+// streamTimer is a timer that can be started and stopped repeatedly. Its channel
+// is nil while it is stopped.
+type streamTimer struct {
+	timer *time.Timer
+	c     <-chan time.Time
+}
+
+func newStreamTimer() *streamTimer {
+	return new(streamTimer)
+}
+
+func (t *streamTimer) start(d time.Duration) {
+	if t.timer == nil {
+		t.timer = time.NewTimer(d)
+	} else {
+		t.timer.Reset(d)
+	}
+	t.c = t.timer.C
+}
+
+func (t *streamTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.c = nil
+}
+
+func (t *streamTimer) running() bool {
+	return t.c != nil
+}
+
+func (t *streamTimer) channel() <-chan time.Time {
+	return t.c
+}
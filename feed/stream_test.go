@@ -0,0 +1,181 @@
+package feed
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("receive timeout")
+	}
+	panic("unreachable")
+}
+
+func TestStreamMapFilter(t *testing.T) {
+	var src FeedOf[int]
+	odd := Filter[int](&src, func(v int) bool { return v%2 == 1 })
+	strs := Map(odd, func(v int) string { return string(rune('a' + v)) })
+
+	ch := make(chan string, 10)
+	sub := strs.Subscribe(ch)
+	defer sub.Unsubscribe()
+
+	for i := 0; i < 6; i++ {
+		src.Send(i)
+	}
+	for _, want := range []string{"b", "d", "f"} {
+		if got := receive(t, ch); got != want {
+			t.Errorf("Got: %q, expected %q", got, want)
+		}
+	}
+}
+
+func TestStreamBatch(t *testing.T) {
+	var src FeedOf[int]
+	batches := Batch[int](&src, 3, 20*time.Millisecond)
+
+	ch := make(chan []int, 10)
+	sub := batches.Subscribe(ch)
+	defer sub.Unsubscribe()
+
+	for i := 0; i < 4; i++ {
+		src.Send(i)
+	}
+	// The first batch is full, the second one is sent after the interval.
+	if got := receive(t, ch); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Errorf("Got: %v, expected [0 1 2]", got)
+	}
+	start := time.Now()
+	if got := receive(t, ch); !reflect.DeepEqual(got, []int{3}) {
+		t.Errorf("Got: %v, expected [3]", got)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("partial batch sent after %v, before the interval", elapsed)
+	}
+}
+
+func TestStreamDebounce(t *testing.T) {
+	var src FeedOf[int]
+	debounced := Debounce[int](&src, 30*time.Millisecond)
+
+	ch := make(chan int, 10)
+	sub := debounced.Subscribe(ch)
+	defer sub.Unsubscribe()
+
+	for i := 0; i < 5; i++ {
+		src.Send(i)
+	}
+	if got := receive(t, ch); got != 4 {
+		t.Errorf("Got: %d, expected 4", got)
+	}
+	select {
+	case v := <-ch:
+		t.Errorf("unexpected value %d", v)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStreamThrottle(t *testing.T) {
+	var src FeedOf[int]
+	throttled := Throttle[int](&src, 30*time.Millisecond)
+
+	ch := make(chan int, 10)
+	sub := throttled.Subscribe(ch)
+	defer sub.Unsubscribe()
+
+	// The first value passes right away, the latest of the rest at the end
+	// of the period.
+	for i := 0; i < 5; i++ {
+		src.Send(i)
+	}
+	if got := receive(t, ch); got != 0 {
+		t.Errorf("Got: %d, expected 0", got)
+	}
+	if got := receive(t, ch); got != 4 {
+		t.Errorf("Got: %d, expected 4", got)
+	}
+	select {
+	case v := <-ch:
+		t.Errorf("unexpected value %d", v)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStreamErr(t *testing.T) {
+	var src Feed
+	batches := Batch(SourceOf[int](&src), 10, 0)
+
+	ch := make(chan []int, 1)
+	sub := batches.Subscribe(ch)
+	// The operator is subscribed to the source once Subscribe returns.
+	if nsent := src.Send(1); nsent != 1 {
+		t.Errorf("send delivered %d times, want 1", nsent)
+	}
+	src.Send(2)
+	src.Close()
+
+	// The pending batch is flushed before the error is delivered.
+	if got := receive(t, ch); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("Got: %v, expected [1 2]", got)
+	}
+	if err := receive(t, sub.Err()); err != ErrFeedClosed {
+		t.Errorf("Got: %v, expected error: %v", err, ErrFeedClosed)
+	}
+	if _, ok := <-sub.Err(); ok {
+		t.Errorf("error channel not closed")
+	}
+	sub.Unsubscribe()
+}
+
+func TestStreamShutdown(t *testing.T) {
+	var src FeedOf[int]
+	mapped := Map[int](&src, func(v int) int { return v * 2 })
+
+	ch1, ch2 := make(chan int, 1), make(chan int, 1)
+	sub1 := mapped.Subscribe(ch1)
+	sub2 := mapped.Subscribe(ch2)
+
+	sub1.Unsubscribe()
+	src.Send(1)
+	if got := receive(t, ch2); got != 2 {
+		t.Errorf("Got: %d, expected 2", got)
+	}
+	// The last unsubscribe stops the operator and ends its source subscription.
+	sub2.Unsubscribe()
+	if nsent := src.Send(2); nsent != 0 {
+		t.Errorf("send delivered %d times after shutdown, want 0", nsent)
+	}
+
+	// Subscribing again restarts it.
+	sub3 := mapped.Subscribe(ch1)
+	defer sub3.Unsubscribe()
+	src.Send(3)
+	if got := receive(t, ch1); got != 6 {
+		t.Errorf("Got: %d, expected 6", got)
+	}
+}
+
+func TestStreamSubscribeTypeMismatch(t *testing.T) {
+	var src Feed
+	src.Send(1)
+	strs := Map(SourceOf[string](&src), func(v string) int { return len(v) })
+
+	// The source subscription fails in Subscribe, not in the operator goroutine.
+	func() {
+		defer func() {
+			if _, ok := recover().(feedTypeError); !ok {
+				t.Errorf("Subscribe with wrong source type did not panic")
+			}
+		}()
+		strs.Subscribe(make(chan int))
+	}()
+	if len(strs.subs) != 0 || strs.quit != nil || len(strs.out.inbox) != 0 {
+		t.Errorf("failed Subscribe left the feed changed")
+	}
+}
@@ -39,6 +39,7 @@ type VicFeed struct {
 	mu     sync.Mutex
 	inbox  caseList
 	etype  reflect.Type
+	subs   []*vicFeedSub // live subscriptions, ended by Close
 	closed bool
 }
 
@@ -54,6 +55,9 @@ func (f *VicFeed) init() {
 //
 // The channel should have ample buffer space to avoid blocking other subscribers.
 // Slow subscribers are not dropped.
+//
+// Subscribing to a closed VicFeed returns a subscription that has already ended
+// with ErrFeedClosed.
 func (f *VicFeed) Subscribe(channel interface{}) Subscription {
 	f.once.Do(f.init)
 
@@ -66,6 +70,14 @@ func (f *VicFeed) Subscribe(channel interface{}) Subscription {
 
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	if !f.typecheck(chantyp.Elem()) {
+		panic(feedTypeError{op: "Subscribe", got: chantyp, want: reflect.ChanOf(reflect.SendDir, f.etype)})
+	}
+	if f.closed {
+		sub.close()
+		return sub
+	}
+	f.subs = append(f.subs, sub)
 
 	// Add the select case to the inbox.
 	// The next Send will add it to f.sendCases.
@@ -74,6 +86,10 @@ func (f *VicFeed) Subscribe(channel interface{}) Subscription {
 	return sub
 }
 
+// typecheck fixes the element type of the feed on first use and reports whether
+// typ matches it. Both Subscribe and Send check against it, so a mismatched
+// channel is rejected when it is subscribed rather than on a later Send.
+//
 // note: callers must hold f.mu
 func (f *VicFeed) typecheck(typ reflect.Type) bool {
 	if f.etype == nil {
@@ -88,6 +104,12 @@ func (f *VicFeed) remove(sub *vicFeedSub) {
 	// that have not been added to f.sendCases yet.
 	ch := sub.channel.Interface()
 	f.mu.Lock()
+	for i, s := range f.subs {
+		if s == sub {
+			f.subs = append(f.subs[:i:i], f.subs[i+1:]...)
+			break
+		}
+	}
 	index := f.inbox.find(ch)
 	if index != -1 {
 		f.inbox = f.inbox.delete(index)
@@ -101,11 +123,47 @@ func (f *VicFeed) remove(sub *vicFeedSub) {
 		// Send will remove the channel from f.sendCases.
 	case <-f.sendLock:
 		// No Send is in progress, delete the channel now that we have the send lock.
-		f.sendCases = f.sendCases.delete(f.sendCases.find(ch))
+		// The channel is already gone if the VicFeed was closed meanwhile.
+		if index := f.sendCases.find(ch); index != -1 {
+			f.sendCases = f.sendCases.delete(index)
+		}
 		f.sendLock <- struct{}{}
 	}
 }
 
+// Close shuts down the VicFeed. A Send blocked on slow subscribers returns, and
+// all subscriptions end: ErrFeedClosed is delivered on their Err channels, which
+// are then closed. Later calls to Send return 0 and later subscriptions end right
+// away. Close may be called concurrently with Send and Unsubscribe, and more than
+// once.
+func (f *VicFeed) Close() {
+	f.once.Do(f.init)
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return
+	}
+	f.closed = true
+	subs := f.subs
+	f.subs, f.inbox = nil, nil
+	f.mu.Unlock()
+
+	select {
+	case f.removeSub <- closeSignal{}:
+		// Send will drop all channels and return.
+	case <-f.sendLock:
+		// No Send is in progress, drop the channels now that we have the send lock.
+		f.sendCases = f.sendCases[:firstSubSendCase]
+		f.sendLock <- struct{}{}
+	}
+	// End the subscriptions once Send is out of the way, as a concurrent
+	// Unsubscribe may be waiting for it.
+	for _, sub := range subs {
+		sub.close()
+	}
+}
+
 // Send delivers to all subscribed channels simultaneously.
 // It returns the number of subscribers that the value was sent to.
 func (f *VicFeed) Send(value interface{}) (nsent int) {
@@ -116,13 +174,18 @@ func (f *VicFeed) Send(value interface{}) (nsent int) {
 
 	// Add new cases from the inbox after taking the send lock.
 	f.mu.Lock()
-	f.sendCases = append(f.sendCases, f.inbox...)
-	f.inbox = nil
-
 	if !f.typecheck(rvalue.Type()) {
+		f.mu.Unlock()
 		f.sendLock <- struct{}{}
 		panic(feedTypeError{op: "Send", got: rvalue.Type(), want: f.etype})
 	}
+	if f.closed {
+		f.mu.Unlock()
+		f.sendLock <- struct{}{}
+		return 0
+	}
+	f.sendCases = append(f.sendCases, f.inbox...)
+	f.inbox = nil
 	f.mu.Unlock()
 
 	// Set the sent value on all channels.
@@ -149,6 +212,11 @@ func (f *VicFeed) Send(value interface{}) (nsent int) {
 		// Select on all the receivers, waiting for them to unblock.
 		chosen, recv, _ := reflect.Select(cases)
 		if chosen == 0 /* <-f.removeSub */ {
+			if recv.Interface() == (closeSignal{}) {
+				// The VicFeed was closed, stop sending.
+				f.sendCases = f.sendCases[:firstSubSendCase]
+				break
+			}
 			index := f.sendCases.find(recv.Interface())
 			f.sendCases = f.sendCases.delete(index)
 			if index >= 0 && index < len(cases) {
@@ -186,6 +254,14 @@ func (sub *vicFeedSub) Err() <-chan error {
 	return sub.err
 }
 
+// close ends the subscription because the VicFeed was closed.
+func (sub *vicFeedSub) close() {
+	sub.errOnce.Do(func() {
+		sub.err <- ErrFeedClosed
+		close(sub.err)
+	})
+}
+
 // func (cs caseList) String() string {
 //     s := "["
 //     for i, cas := range cs {
@@ -54,7 +54,6 @@ func TestVicFeedPanics(t *testing.T) {
 		}
 	}
 	{
-		// This issue is raised
 		// sub before send
 		var f VicFeed
 		ch := make(chan int)
@@ -68,11 +67,10 @@ func TestVicFeedPanics(t *testing.T) {
 		}
 	}
 	{
-		// This issue is raised
 		// send before sub
 		var f VicFeed
 		f.Send(int(0))
-		expected := feedTypeError{op: "Send", got: reflect.TypeOf(uint64(0)), want: reflect.TypeOf(int(0))}
+		expected := feedTypeError{op: "Subscribe", got: reflect.TypeOf(make(chan uint64)), want: reflect.TypeOf(make(chan<- int))}
 		secondSend := func() {
 			f.Subscribe(make(chan uint64))
 		}